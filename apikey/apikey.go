@@ -0,0 +1,208 @@
+// Package apikey loads App Store Connect API keys and creates the JWTs
+// used to authenticate with Apple web services such as the Notary API.
+package apikey
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Key is an App Store Connect API key.
+type Key struct {
+	// ID is the key ID as shown on the App Store Connect portal. This is
+	// used as the "kid" header of the tokens.
+	ID string
+
+	// Issuer is the issuer ID of the key. This is used as the "iss" claim
+	// of the tokens.
+	Issuer string
+
+	// PrivateKey is the private key used for signing the tokens.
+	PrivateKey *ecdsa.PrivateKey
+}
+
+var (
+	keyIdRe  = regexp.MustCompile(`^[A-Z0-9]{10}$`)
+	issuerRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// Load loads the `.p8` key at path. If path is empty the key is searched
+// for with Find. If the file name follows Apple's 'AuthKey_<id>.p8'
+// naming, the ID in the name must match id.
+func Load(path, id, issuer string) (*Key, error) {
+	if err := validateIds(id, issuer); err != nil {
+		return nil, err
+	}
+
+	if path == "" {
+		var err error
+		path, err = Find(id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, "AuthKey_") && strings.HasSuffix(name, ".p8") {
+		fileId := strings.TrimSuffix(strings.TrimPrefix(name, "AuthKey_"), ".p8")
+		if fileId != id {
+			return nil, fmt.Errorf(
+				"API key file %q belongs to key %q, but api_key is %q", path, fileId, id)
+		}
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading API key file: %w", err)
+	}
+
+	key, err := Parse(raw, id, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return key, nil
+}
+
+// Parse parses the PEM encoded contents of a `.p8` key.
+func Parse(raw []byte, id, issuer string) (*Key, error) {
+	if err := validateIds(id, issuer); err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("API key is not PEM encoded")
+	}
+	if block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("API key has PEM type %q, expected \"PRIVATE KEY\"", block.Type)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing API key: %w", err)
+	}
+
+	priv, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok || priv.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("API key is not an ECDSA P-256 key")
+	}
+
+	return &Key{
+		ID:         id,
+		Issuer:     issuer,
+		PrivateKey: priv,
+	}, nil
+}
+
+// Decode returns the PEM encoded key of content, which is either the
+// contents of a `.p8` file or their base64 encoding. The latter is how CI
+// systems usually keep multi-line secrets in environment variables.
+func Decode(content string) ([]byte, error) {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "-----BEGIN") {
+		return []byte(content + "\n"), nil
+	}
+
+	// Line breaks are common in base64 encoded secrets
+	content = strings.Join(strings.Fields(content), "")
+	raw, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return nil, fmt.Errorf("API key content is neither PEM nor base64 encoded: %w", err)
+	}
+
+	return raw, nil
+}
+
+// ParseContent parses the contents of a `.p8` key given as is or base64
+// encoded, see Decode.
+func ParseContent(content, id, issuer string) (*Key, error) {
+	raw, err := Decode(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(raw, id, issuer)
+}
+
+// WriteTemp writes the key content, see Decode, to an 'AuthKey_<id>.p8'
+// file in a new temporary directory that only the current user can read,
+// for tools such as notarytool that take a key file. The returned function
+// removes the directory; it must be called on every path, e.g. deferred.
+func WriteTemp(content, id string) (string, func(), error) {
+	raw, err := Decode(content)
+	if err != nil {
+		return "", nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "gon")
+	if err != nil {
+		return "", nil, err
+	}
+	remove := func() { os.RemoveAll(dir) }
+
+	path := filepath.Join(dir, "AuthKey_"+id+".p8")
+	if err := ioutil.WriteFile(path, raw, 0600); err != nil {
+		remove()
+		return "", nil, fmt.Errorf("error writing API key file: %w", err)
+	}
+
+	return path, remove, nil
+}
+
+// Find searches for an 'AuthKey_<id>.p8' file in the same directories as
+// `xcrun altool` does: './private_keys', '~/private_keys', '~/.private_keys'
+// and '~/.appstoreconnect/private_keys'. If the API_PRIVATE_KEYS_DIR
+// environment variable is set, only that directory is searched.
+func Find(id string) (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("can't resolve homedir: %w", err)
+	}
+
+	// `xcrun altool --help` -- apiKey param comment.
+	altoolDefaultDirs := []string{
+		"./private_keys",
+		"~/private_keys",
+		"~/.private_keys",
+		"~/.appstoreconnect/private_keys",
+	}
+	if envDir := os.Getenv("API_PRIVATE_KEYS_DIR"); envDir != "" {
+		altoolDefaultDirs = []string{envDir}
+	}
+
+	keyName := "AuthKey_" + id + ".p8"
+	for _, dir := range altoolDefaultDirs {
+		if strings.HasPrefix(dir, "~/") {
+			dir = filepath.Join(usr.HomeDir, dir[2:])
+		}
+		path := filepath.Join(dir, keyName)
+		if s, err := os.Stat(path); err == nil && s.Mode().IsRegular() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("can't found an API key file in default dirs")
+}
+
+// validateIds checks the shape of the key and issuer IDs so typos are
+// reported before Apple rejects the token with a generic 401.
+func validateIds(id, issuer string) error {
+	if !keyIdRe.MatchString(id) {
+		return fmt.Errorf("invalid API key ID %q: expected 10 upper case letters or digits", id)
+	}
+	if !issuerRe.MatchString(issuer) {
+		return fmt.Errorf("invalid API key issuer %q: expected a UUID", issuer)
+	}
+
+	return nil
+}
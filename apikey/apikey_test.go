@@ -0,0 +1,144 @@
+package apikey
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testKeyId  = "ABCDEF1234"
+	testIssuer = "57246542-96fe-1a63-e053-0824d011072a"
+)
+
+func TestLoad(t *testing.T) {
+	require := require.New(t)
+
+	path := testKeyFile(t, t.TempDir(), "AuthKey_"+testKeyId+".p8", elliptic.P256())
+	key, err := Load(path, testKeyId, testIssuer)
+	require.NoError(err)
+	require.Equal(testKeyId, key.ID)
+	require.Equal(testIssuer, key.Issuer)
+	require.NotNil(key.PrivateKey)
+}
+
+func TestLoad_find(t *testing.T) {
+	dir := t.TempDir()
+	testKeyFile(t, dir, "AuthKey_"+testKeyId+".p8", elliptic.P256())
+
+	defer os.Setenv("API_PRIVATE_KEYS_DIR", os.Getenv("API_PRIVATE_KEYS_DIR"))
+	require.NoError(t, os.Setenv("API_PRIVATE_KEYS_DIR", dir))
+
+	_, err := Load("", testKeyId, testIssuer)
+	require.NoError(t, err)
+
+	_, err = Load("", "ZZZZZZ9999", testIssuer)
+	require.Error(t, err)
+}
+
+func TestLoad_mismatchedName(t *testing.T) {
+	path := testKeyFile(t, t.TempDir(), "AuthKey_ZZZZZZ9999.p8", elliptic.P256())
+	_, err := Load(path, testKeyId, testIssuer)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "belongs to key \"ZZZZZZ9999\"")
+}
+
+func TestLoad_invalidIds(t *testing.T) {
+	path := testKeyFile(t, t.TempDir(), "key.p8", elliptic.P256())
+
+	_, err := Load(path, "abc", testIssuer)
+	require.Error(t, err)
+
+	_, err = Load(path, testKeyId, "not-a-uuid")
+	require.Error(t, err)
+}
+
+func TestParse_malformed(t *testing.T) {
+	_, err := Parse([]byte("hello"), testKeyId, testIssuer)
+	require.Error(t, err)
+
+	_, err = Parse(pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: []byte("garbage"),
+	}), testKeyId, testIssuer)
+	require.Error(t, err)
+}
+
+func TestParse_wrongCurve(t *testing.T) {
+	path := testKeyFile(t, t.TempDir(), "key.p8", elliptic.P384())
+	raw, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	_, err = Parse(raw, testKeyId, testIssuer)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "P-256")
+}
+
+func TestParseContent(t *testing.T) {
+	require := require.New(t)
+
+	path := testKeyFile(t, t.TempDir(), "key.p8", elliptic.P256())
+	raw, err := ioutil.ReadFile(path)
+	require.NoError(err)
+
+	// As is, and base64 encoded with line breaks
+	_, err = ParseContent(string(raw), testKeyId, testIssuer)
+	require.NoError(err)
+
+	encoded := base64.StdEncoding.EncodeToString(raw)
+	_, err = ParseContent(encoded[:40]+"\n"+encoded[40:]+"\n", testKeyId, testIssuer)
+	require.NoError(err)
+
+	_, err = ParseContent("not a key!", testKeyId, testIssuer)
+	require.Error(err)
+	require.Contains(err.Error(), "neither PEM nor base64")
+}
+
+func TestWriteTemp(t *testing.T) {
+	require := require.New(t)
+
+	path := testKeyFile(t, t.TempDir(), "key.p8", elliptic.P256())
+	raw, err := ioutil.ReadFile(path)
+	require.NoError(err)
+
+	tempPath, remove, err := WriteTemp(base64.StdEncoding.EncodeToString(raw), testKeyId)
+	require.NoError(err)
+	require.Equal("AuthKey_"+testKeyId+".p8", filepath.Base(tempPath))
+
+	info, err := os.Stat(tempPath)
+	require.NoError(err)
+	require.Equal(os.FileMode(0600), info.Mode().Perm())
+	_, err = Load(tempPath, testKeyId, testIssuer)
+	require.NoError(err)
+
+	remove()
+	_, err = os.Stat(filepath.Dir(tempPath))
+	require.True(os.IsNotExist(err))
+}
+
+// testKeyFile writes a new PKCS#8 encoded key to dir/name.
+func testKeyFile(t *testing.T, dir, name string, curve elliptic.Curve) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	}), 0600))
+
+	return path
+}
@@ -0,0 +1,137 @@
+package apikey
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAudience is the audience of App Store Connect API tokens.
+	DefaultAudience = "appstoreconnect-v1"
+
+	// DefaultLifetime is the lifetime of tokens created by a Signer if
+	// none is specified.
+	DefaultLifetime = 15 * time.Minute
+
+	// MaxLifetime is the longest lifetime Apple accepts for a token.
+	MaxLifetime = 20 * time.Minute
+
+	// renewBefore is how long before expiry a cached token is renewed, so
+	// a token is never sent that expires while the request is in flight.
+	renewBefore = time.Minute
+)
+
+// Signer creates ES256 signed JWTs for an API key. Tokens are cached and
+// renewed shortly before they expire, so Token can be called for every
+// request. It is safe for concurrent use. A Signer must not be copied
+// after first use.
+type Signer struct {
+	// Key is the API key to sign tokens with. This is required.
+	Key *Key
+
+	// Audience is the "aud" claim. Defaults to DefaultAudience.
+	Audience string
+
+	// Lifetime is how long each token is valid for. Defaults to
+	// DefaultLifetime and can't be longer than MaxLifetime.
+	Lifetime time.Duration
+
+	// Now returns the current time. This is used for tests. If this is
+	// nil then time.Now is used.
+	Now func() time.Time
+
+	lock    sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// Token returns a valid token, creating a new one if the cached token is
+// about to expire.
+func (s *Signer) Token() (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+
+	if s.token != "" && now.Add(renewBefore).Before(s.expires) {
+		return s.token, nil
+	}
+
+	if s.Key == nil || s.Key.PrivateKey == nil {
+		return "", fmt.Errorf("no API key given to sign tokens with")
+	}
+
+	lifetime := s.Lifetime
+	if lifetime == 0 {
+		lifetime = DefaultLifetime
+	}
+	if lifetime > MaxLifetime {
+		return "", fmt.Errorf("token lifetime %s is longer than the allowed %s", lifetime, MaxLifetime)
+	}
+
+	audience := s.Audience
+	if audience == "" {
+		audience = DefaultAudience
+	}
+
+	expires := now.Add(lifetime)
+	token, err := sign(s.Key, map[string]interface{}{
+		"iss": s.Key.Issuer,
+		"iat": now.Unix(),
+		"exp": expires.Unix(),
+		"aud": audience,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	s.token = token
+	s.expires = expires
+	return token, nil
+}
+
+// sign creates a compact JWS of the claims signed with the key.
+func sign(key *Key, claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "ES256",
+		"kid": key.ID,
+		"typ": "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, key.PrivateKey, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("error signing token: %w", err)
+	}
+
+	// JWS wants the raw fixed-size r || s, not the ASN.1 encoding.
+	sig := make([]byte, 64)
+	padBigInt(sig[:32], r)
+	padBigInt(sig[32:], s)
+
+	return signingInput + "." + enc.EncodeToString(sig), nil
+}
+
+func padBigInt(dst []byte, v *big.Int) {
+	b := v.Bytes()
+	copy(dst[len(dst)-len(b):], b)
+}
@@ -0,0 +1,119 @@
+package apikey
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigner_token(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1700000000, 0)
+	s := &Signer{
+		Key: testKey(t),
+		Now: func() time.Time { return now },
+	}
+
+	token, err := s.Token()
+	require.NoError(err)
+
+	header, claims := testVerify(t, s.Key, token)
+	require.Equal("ES256", header["alg"])
+	require.Equal(testKeyId, header["kid"])
+	require.Equal("JWT", header["typ"])
+	require.Equal(testIssuer, claims["iss"])
+	require.Equal(DefaultAudience, claims["aud"])
+	require.Equal(float64(now.Unix()), claims["iat"])
+	require.Equal(float64(now.Add(DefaultLifetime).Unix()), claims["exp"])
+}
+
+func TestSigner_cache(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1700000000, 0)
+	s := &Signer{
+		Key: testKey(t),
+		Now: func() time.Time { return now },
+	}
+
+	first, err := s.Token()
+	require.NoError(err)
+
+	// Reused while the token is fresh
+	now = now.Add(10 * time.Minute)
+	second, err := s.Token()
+	require.NoError(err)
+	require.Equal(first, second)
+
+	// Renewed shortly before it expires
+	now = now.Add(4*time.Minute + 30*time.Second)
+	third, err := s.Token()
+	require.NoError(err)
+	require.NotEqual(first, third)
+
+	_, claims := testVerify(t, s.Key, third)
+	require.Equal(float64(now.Add(DefaultLifetime).Unix()), claims["exp"])
+}
+
+func TestSigner_lifetimeTooLong(t *testing.T) {
+	s := &Signer{
+		Key:      testKey(t),
+		Lifetime: time.Hour,
+	}
+
+	_, err := s.Token()
+	require.Error(t, err)
+}
+
+func TestSigner_noKey(t *testing.T) {
+	_, err := (&Signer{}).Token()
+	require.Error(t, err)
+}
+
+func testKey(t *testing.T) *Key {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	return &Key{ID: testKeyId, Issuer: testIssuer, PrivateKey: priv}
+}
+
+// testVerify checks the token signature and returns the decoded header
+// and claims.
+func testVerify(t *testing.T, key *Key, token string) (map[string]interface{}, map[string]interface{}) {
+	t.Helper()
+
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+
+	enc := base64.RawURLEncoding
+	sig, err := enc.DecodeString(parts[2])
+	require.NoError(t, err)
+	require.Len(t, sig, 64)
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	require.True(t, ecdsa.Verify(&key.PrivateKey.PublicKey, digest[:], r, s), "invalid signature")
+
+	var header, claims map[string]interface{}
+	raw, err := enc.DecodeString(parts[0])
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, &header))
+	raw, err = enc.DecodeString(parts[1])
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, &claims))
+
+	return header, claims
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+
+	"github.com/bi-zone/gon/config"
+	"github.com/bi-zone/gon/notarize"
+	"github.com/bi-zone/gon/pipeline"
+	"github.com/bi-zone/gon/secret"
+	"github.com/bi-zone/gon/staple"
+)
+
+// commands are the subcommands of gon. Without a subcommand the whole
+// configuration is processed.
+var commands map[string]func(args []string) int
+
+func init() {
+	commands = map[string]func(args []string) int{
+		"validate":          validateMain,
+		"sign":              stageMain("sign", "Sign the source files of a configuration.", pipeline.StageSign),
+		"zip":               stageMain("zip", "Create the zip archives of a configuration.", pipeline.StageZip),
+		"dmg":               stageMain("dmg", "Create and sign the dmg files of a configuration.", pipeline.StageDmg),
+		"notarize":          notarizeMain,
+		"staple":            stapleMain,
+		"status":            statusMain,
+		"log":               logMain,
+		"explain":           explainMain,
+		"store-credentials": storeCredentialsMain,
+	}
+}
+
+// newCommandFlags returns the flag set of a subcommand with its help.
+func newCommandFlags(name, usage, help string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stdout, "%s\n\nUsage: %s %s %s\n\n", help, os.Args[0], name, usage)
+		if strings.Contains(usage, "[flags]") {
+			fmt.Fprintf(os.Stdout, "Flags:\n\n")
+			flags.PrintDefaults()
+		}
+	}
+
+	return flags
+}
+
+// parseCommandFlags parses the flags of a subcommand that takes a single
+// argument and returns that argument.
+func parseCommandFlags(flags *flag.FlagSet, args []string, what string) (string, bool) {
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stdout, color.RedString("❗️ %s expected.\n\n", what))
+		flags.Usage()
+		return "", false
+	}
+
+	return flags.Arg(0), true
+}
+
+// stageMain returns the entrypoint of a subcommand that runs a single
+// stage of the configuration.
+func stageMain(name, help string, stage pipeline.Stage) func(args []string) int {
+	return func(args []string) int {
+		flags := newCommandFlags(name, "[flags] CONFIG", help)
+		var logFlags logFlags
+		logFlags.register(flags)
+		var stateFlags stateFlags
+		stateFlags.register(flags)
+		var timeoutFlags timeoutFlags
+		timeoutFlags.register(flags)
+		var cfgFlags configFlags
+		cfgFlags.register(flags)
+		path, ok := parseCommandFlags(flags, args, "Path to configuration")
+		if !ok {
+			return 1
+		}
+
+		cfg, diags := loadConfig(path, cfgFlags.loadOptions())
+		printDiagnostics(diags)
+		if diags.HasErrors() {
+			return 1
+		}
+
+		ctx, stop := interruptContext()
+		defer stop()
+
+		out := newOutput(ctx)
+		result, err := pipeline.Run(ctx, &pipeline.Options{
+			Config:         cfg,
+			Targets:        cfgFlags.Targets,
+			Stages:         []pipeline.Stage{stage},
+			StateFile:      stateFlags.path(),
+			Resume:         stateFlags.Resume,
+			Timeout:        timeoutFlags.Total,
+			CommandTimeout: timeoutFlags.Command,
+			Events:         out.Event,
+			Logger:         logFlags.logger(),
+		})
+		if ctx.Err() != nil {
+			out.summary(result, stateFlags.path() != "")
+			return 1
+		}
+		if pipeline.IsTimeout(err) {
+			out.summary(result, stateFlags.path() != "")
+			return exitTimeout
+		}
+		if err != nil {
+			out.unreported(err)
+			return 1
+		}
+
+		return 0
+	}
+}
+
+// notarizeMain is the entrypoint of "gon notarize", which notarizes and
+// optionally staples a single file that is ready for notarization.
+func notarizeMain(args []string) int {
+	flags := newCommandFlags("notarize", "[flags] FILE",
+		"Notarize a zip, dmg or pkg file that is ready for notarization.")
+	doStaple := flags.Bool("staple", false, "Staple the notarization ticket to the file. Only dmg, pkg and app files support stapling.")
+	var logFlags logFlags
+	logFlags.register(flags)
+	var notaryFlags notaryFlags
+	notaryFlags.register(flags)
+	var stateFlags stateFlags
+	stateFlags.register(flags)
+	var timeoutFlags timeoutFlags
+	timeoutFlags.register(flags)
+	timeoutFlags.registerNotarize(flags)
+	var credFlags credentialFlags
+	credFlags.register(flags)
+	path, ok := parseCommandFlags(flags, args, "Path to the file")
+	if !ok {
+		return 1
+	}
+
+	cfg := &config.Config{
+		Notarize: []config.Notarize{{Path: path, Staple: *doStaple}},
+		AppleId:  &credFlags.AppleId,
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	out := newOutput(ctx)
+	result, err := pipeline.Run(ctx, &pipeline.Options{
+		Config:          cfg,
+		StateFile:       stateFlags.path(),
+		Resume:          stateFlags.Resume,
+		NotaryAPI:       notaryFlags.API,
+		PollingInterval: &notaryFlags.PollInterval,
+		SaveLogs:        notaryFlags.SaveLog,
+		Timeout:         timeoutFlags.Total,
+		NotarizeTimeout: timeoutFlags.Notarize,
+		CommandTimeout:  timeoutFlags.Command,
+		Events:          out.Event,
+		Logger:          logFlags.logger(),
+	})
+	if ctx.Err() != nil {
+		out.summary(result, stateFlags.path() != "")
+		return 1
+	}
+	if pipeline.IsTimeout(err) {
+		out.summary(result, stateFlags.path() != "")
+		return exitTimeout
+	}
+	if err != nil {
+		out.unreported(err)
+		return 1
+	}
+
+	return 0
+}
+
+// stapleMain is the entrypoint of "gon staple".
+func stapleMain(args []string) int {
+	flags := newCommandFlags("staple", "[flags] FILE",
+		"Staple the notarization ticket to a notarized dmg, pkg or app file.")
+	var logFlags logFlags
+	logFlags.register(flags)
+	var timeoutFlags timeoutFlags
+	timeoutFlags.register(flags)
+	path, ok := parseCommandFlags(flags, args, "Path to the file")
+	if !ok {
+		return 1
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	ctx, cancel := timeoutFlags.context(ctx)
+	defer cancel()
+
+	color.New(color.Bold).Fprintf(os.Stdout, "==> %s  Stapling %s...\n", iconNotarize, path)
+	err := staple.Staple(ctx, &staple.Options{
+		File:    path,
+		Logger:  logFlags.logger().Named("staple"),
+		Timeout: timeoutFlags.Command,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stdout, color.RedString("❗️ Error stapling:\n\n%s\n", secret.Redact(err.Error())))
+		return exitStatus(err)
+	}
+
+	color.New(color.Bold, color.FgGreen).Fprintf(os.Stdout, "    File stapled!\n")
+	return 0
+}
+
+// statusMain is the entrypoint of "gon status", which shows the status of
+// a notarization request.
+func statusMain(args []string) int {
+	flags := newCommandFlags("status", "[flags] UUID",
+		"Show the status of a notarization request.")
+	var logFlags logFlags
+	logFlags.register(flags)
+	var notaryFlags notaryFlags
+	notaryFlags.register(flags)
+	var timeoutFlags timeoutFlags
+	timeoutFlags.register(flags)
+	var credFlags credentialFlags
+	credFlags.register(flags)
+	uuid, ok := parseCommandFlags(flags, args, "Request UUID")
+	if !ok {
+		return 1
+	}
+
+	opts, ok := credFlags.notarizeOptions(&notaryFlags, logFlags.logger())
+	if !ok {
+		return 1
+	}
+	opts.CommandTimeout = timeoutFlags.Command
+
+	ctx, stop := interruptContext()
+	defer stop()
+	ctx, cancel := timeoutFlags.context(ctx)
+	defer cancel()
+
+	info, err := notarize.RequestInfo(ctx, uuid, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stdout, color.RedString("❗️ Error requesting notarization status:\n\n%s\n", secret.Redact(err.Error())))
+		if hint := notarizeHint(err); hint != "" {
+			color.New(color.FgYellow).Fprintf(os.Stdout, "\n%s\n", hint)
+		}
+		return exitStatus(err)
+	}
+
+	fmt.Fprintf(os.Stdout, "Request UUID: %s\n", info.RequestUUID)
+	fmt.Fprintf(os.Stdout, "Name:         %s\n", info.Name)
+	fmt.Fprintf(os.Stdout, "Date:         %s\n", info.Date)
+	fmt.Fprintf(os.Stdout, "Status:       %s\n", info.Status)
+	if info.StatusMessage != "" {
+		fmt.Fprintf(os.Stdout, "Message:      %s\n", info.StatusMessage)
+	}
+
+	return 0
+}
+
+// logMain is the entrypoint of "gon log", which prints the notarization
+// log of a request as JSON.
+func logMain(args []string) int {
+	flags := newCommandFlags("log", "[flags] UUID",
+		"Print the notarization log of a processed request as JSON.")
+	var logFlags logFlags
+	logFlags.register(flags)
+	var notaryFlags notaryFlags
+	notaryFlags.register(flags)
+	var timeoutFlags timeoutFlags
+	timeoutFlags.register(flags)
+	var credFlags credentialFlags
+	credFlags.register(flags)
+	uuid, ok := parseCommandFlags(flags, args, "Request UUID")
+	if !ok {
+		return 1
+	}
+
+	opts, ok := credFlags.notarizeOptions(&notaryFlags, logFlags.logger())
+	if !ok {
+		return 1
+	}
+	opts.CommandTimeout = timeoutFlags.Command
+
+	ctx, stop := interruptContext()
+	defer stop()
+	ctx, cancel := timeoutFlags.context(ctx)
+	defer cancel()
+
+	log, err := notarize.RequestLog(ctx, uuid, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stdout, color.RedString("❗️ Error requesting notarization log:\n\n%s\n", secret.Redact(err.Error())))
+		if hint := notarizeHint(err); hint != "" {
+			color.New(color.FgYellow).Fprintf(os.Stdout, "\n%s\n", hint)
+		}
+		return exitStatus(err)
+	}
+
+	out, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stdout, color.RedString("❗️ Error encoding notarization log:\n\n%s\n", err))
+		return 1
+	}
+	fmt.Fprintf(os.Stdout, "%s\n", out)
+
+	return 0
+}
+
+// explainMain is the entrypoint of "gon explain", which prints the issues
+// of a notarization log saved earlier, with how to fix them.
+func explainMain(args []string) int {
+	flags := newCommandFlags("explain", "LOG",
+		"Explain the issues of a notarization log, such as one saved with -save-log\n"+
+			"or printed by \"gon log\". If LOG is \"-\", the log is read from stdin.")
+	path, ok := parseCommandFlags(flags, args, "Notarization log")
+	if !ok {
+		return 1
+	}
+
+	var raw []byte
+	var err error
+	if path == "-" {
+		raw, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		raw, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stdout, color.RedString("❗️ Error reading notarization log:\n\n%s\n", err))
+		return 1
+	}
+
+	var log notarize.Log
+	if err := json.Unmarshal(raw, &log); err != nil {
+		fmt.Fprintf(os.Stdout, color.RedString("❗️ Error decoding notarization log:\n\n%s\n", err))
+		return 1
+	}
+
+	if len(log.Issues) == 0 {
+		color.New(color.FgGreen).Fprintf(os.Stdout, "No issues in the notarization log, status: %s\n", log.Status)
+		return 0
+	}
+
+	printIssues("", &log)
+	return 0
+}
+
+// storeCredentialsMain is the entrypoint of "gon store-credentials", which
+// stores the credentials of each apple_id block of a configuration in the
+// notarytool keychain profile named by its keychain_profile.
+func storeCredentialsMain(args []string) int {
+	flags := newCommandFlags("store-credentials", "[flags] CONFIG",
+		"Store the apple_id credentials of a configuration in the notarytool keychain\n"+
+			"profile named by keychain_profile, so the configuration only needs the profile\n"+
+			"name afterwards. The credentials are validated with Apple first.")
+	var logFlags logFlags
+	logFlags.register(flags)
+	var timeoutFlags timeoutFlags
+	timeoutFlags.register(flags)
+	var cfgFlags configFlags
+	cfgFlags.register(flags)
+	path, ok := parseCommandFlags(flags, args, "Path to configuration")
+	if !ok {
+		return 1
+	}
+
+	cfg, diags := loadConfig(path, cfgFlags.loadOptions())
+	if !diags.HasErrors() {
+		diags = append(diags, config.Validate(cfg, &config.ValidateOptions{
+			Targets:      cfgFlags.Targets,
+			DontNotarize: true,
+		})...)
+	}
+	printDiagnostics(diags)
+	if diags.HasErrors() {
+		return 1
+	}
+
+	targets, err := cfg.SelectTargets(cfgFlags.Targets)
+	if err != nil {
+		fmt.Fprintf(os.Stdout, color.RedString("❗️ %s\n", err))
+		return 1
+	}
+
+	// Targets without their own apple_id share the top-level one, so each
+	// block is only stored once.
+	var stores []config.AppleId
+	seen := map[*config.AppleId]bool{}
+	for _, t := range targets {
+		if seen[t.AppleId] {
+			continue
+		}
+		seen[t.AppleId] = true
+
+		diags := t.AppleId.ValidateStore()
+		printDiagnostics(diags)
+		if diags.HasErrors() {
+			return 1
+		}
+
+		var creds config.AppleId
+		if t.AppleId != nil {
+			creds = *t.AppleId
+		}
+		creds.ApplyEnv()
+		stores = append(stores, creds)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	ctx, cancel := timeoutFlags.context(ctx)
+	defer cancel()
+
+	logger := logFlags.logger()
+	for _, creds := range stores {
+		color.New(color.Bold).Fprintf(os.Stdout, "==> 🔑  Storing credentials in keychain profile %q...\n", creds.KeychainProfile)
+		err := notarize.StoreCredentials(ctx, &notarize.Options{
+			DeveloperId:     creds.Username,
+			Password:        creds.Password,
+			Provider:        creds.Provider,
+			ApiKey:          creds.ApiKey,
+			ApiIssuer:       creds.ApiIssuer,
+			ApiKeyPath:      creds.ApiKeyPath,
+			ApiKeyContent:   creds.ApiKeyContent,
+			KeychainProfile: creds.KeychainProfile,
+			Logger:          logger.Named("notarize"),
+			CommandTimeout:  timeoutFlags.Command,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stdout, color.RedString("❗️ Error storing credentials:\n\n%s\n", secret.Redact(err.Error())))
+			if hint := notarizeHint(err); hint != "" {
+				color.New(color.FgYellow).Fprintf(os.Stdout, "\n%s\n", hint)
+			}
+			return exitStatus(err)
+		}
+
+		color.New(color.Bold, color.FgGreen).Fprintf(os.Stdout, "    Credentials stored\n")
+	}
+
+	return 0
+}
+
+// exitStatus returns the exit status for the error of a single command.
+func exitStatus(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return exitTimeout
+	}
+
+	return 1
+}
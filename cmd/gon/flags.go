@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/bi-zone/gon/config"
+	"github.com/bi-zone/gon/notarize"
+)
+
+// logFlags are the flags for logging, shared by all commands.
+type logFlags struct {
+	Level string
+	JSON  bool
+}
+
+// register adds the flags to fs.
+func (l *logFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&l.JSON, "log-json", false, "Output logs in JSON format for machine readability.")
+	fs.StringVar(&l.Level, "log-level", "", "Log level to output. Defaults to no logging.")
+}
+
+// logger builds a logger. Without a level nothing is logged.
+func (l *logFlags) logger() hclog.Logger {
+	logOut := ioutil.Discard
+	if l.Level != "" {
+		logOut = os.Stderr
+	}
+
+	return hclog.New(&hclog.LoggerOptions{
+		Level:      hclog.LevelFromString(l.Level),
+		Output:     logOut,
+		JSONFormat: l.JSON,
+	})
+}
+
+// notaryFlags are the flags for talking to the notary service, shared by
+// all commands that notarize.
+type notaryFlags struct {
+	PollInterval time.Duration
+	API          bool
+	SaveLog      bool
+}
+
+// register adds the flags to fs.
+func (n *notaryFlags) register(fs *flag.FlagSet) {
+	fs.DurationVar(&n.PollInterval, "poll-interval", 30*time.Second, "Specify interval for notarization polling.")
+	fs.BoolVar(&n.API, "notary-api", false, "Talk to the Apple Notary web API directly instead of using notarytool. Requires an API key.")
+	fs.BoolVar(&n.SaveLog, "save-log", false, "Save the notarization log of each file next to it as <file>.notarization.json.")
+}
+
+// stateFlags are the flags for saving and resuming the progress of a run.
+type stateFlags struct {
+	File   string
+	Resume bool
+}
+
+// defaultStateFile is the state file of -resume if -state-file isn't set.
+const defaultStateFile = ".gon-state.json"
+
+// register adds the flags to fs.
+func (s *stateFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.File, "state-file", "", "File to save the progress to so an interrupted run can be resumed. Defaults to "+defaultStateFile+" with -resume.")
+	fs.BoolVar(&s.Resume, "resume", false, "Save the progress to the state file, and resume from it: skip the stages already done and wait for existing notarization requests.")
+}
+
+// path returns the state file to save the progress to, empty if neither
+// -state-file nor -resume is set. A plain run doesn't write any files
+// other than its outputs.
+func (s *stateFlags) path() string {
+	if s.File == "" && s.Resume {
+		return defaultStateFile
+	}
+
+	return s.File
+}
+
+// timeoutFlags are the flags for the timeouts of a run. They take
+// precedence over the timeouts block of the configuration.
+type timeoutFlags struct {
+	Total    time.Duration
+	Notarize time.Duration
+	Command  time.Duration
+}
+
+// register adds the flags for the total and command timeouts to fs.
+func (t *timeoutFlags) register(fs *flag.FlagSet) {
+	fs.DurationVar(&t.Total, "timeout", 0, "Stop if the run takes longer than this, e.g. 2h. Defaults to the configuration or no limit.")
+	fs.DurationVar(&t.Command, "command-timeout", 0, "Stop if a single codesign, ditto, create-dmg, notarytool or stapler command takes longer than this. Defaults to the configuration or no limit.")
+}
+
+// context returns ctx limited by the total timeout, if set.
+func (t *timeoutFlags) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t.Total <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, t.Total)
+}
+
+// registerNotarize adds the flag for the notarization timeout to fs.
+func (t *timeoutFlags) registerNotarize(fs *flag.FlagSet) {
+	fs.DurationVar(&t.Notarize, "notarize-timeout", 0, "Stop if notarizing a file takes longer than this, including the wait in Apple's queue. Defaults to the configuration or no limit.")
+}
+
+// credentialFlags are the flags for the Apple credentials of commands that
+// don't take a configuration. They default to the same environment
+// variables as the apple_id block.
+type credentialFlags struct {
+	config.AppleId
+}
+
+// register adds the flags to fs.
+func (c *credentialFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.Username, "apple-id", "", "Apple ID username. Defaults to AC_USERNAME.")
+	fs.StringVar(&c.Password, "password", "", "Apple ID password, or @env:NAME, @keychain:NAME or @file:PATH. Defaults to @env:AC_PASSWORD.")
+	fs.StringVar(&c.Provider, "provider", "", "Team ID of the Apple ID. Defaults to AC_PROVIDER.")
+	fs.StringVar(&c.ApiKey, "api-key", "", "App Store Connect API key ID. Defaults to AC_APIKEY.")
+	fs.StringVar(&c.ApiIssuer, "api-issuer", "", "App Store Connect API key issuer. Defaults to AC_APIISSUER.")
+	fs.StringVar(&c.ApiKeyPath, "api-key-path", "", "Path to the App Store Connect API key file. Defaults to the content of AC_APIKEY_CONTENT, or searching the altool directories.")
+	fs.StringVar(&c.KeychainProfile, "keychain-profile", "", "notarytool keychain profile holding the credentials. Defaults to AC_KEYCHAIN_PROFILE.")
+}
+
+// notarizeOptions validates the credentials and returns the options to
+// talk to the notary service with. The diagnostics are printed.
+func (c *credentialFlags) notarizeOptions(n *notaryFlags, logger hclog.Logger) (*notarize.Options, bool) {
+	diags := c.AppleId.Validate()
+	printDiagnostics(diags)
+	if diags.HasErrors() {
+		return nil, false
+	}
+
+	creds := c.AppleId
+	creds.ApplyEnv()
+
+	var api *notarize.API
+	if n.API {
+		api = &notarize.API{}
+	}
+
+	return &notarize.Options{
+		DeveloperId:     creds.Username,
+		Password:        creds.Password,
+		Provider:        creds.Provider,
+		ApiKey:          creds.ApiKey,
+		ApiIssuer:       creds.ApiIssuer,
+		ApiKeyPath:      creds.ApiKeyPath,
+		ApiKeyContent:   creds.ApiKeyContent,
+		KeychainProfile: creds.KeychainProfile,
+		Logger:          logger.Named("notarize"),
+		PollingInterval: &n.PollInterval,
+		API:             api,
+	}, true
+}
+
+// configFlags are the flags for loading the configuration, shared by all
+// commands that take a configuration.
+type configFlags struct {
+	Format        string
+	Targets       stringSliceFlag
+	Vars          varFlag
+	VarFiles      repeatedFlag
+	LegacyEnvVars bool
+}
+
+// register adds the flags to fs.
+func (c *configFlags) register(fs *flag.FlagSet) {
+	c.Vars = varFlag{}
+	fs.StringVar(&c.Format, "config-format", "", "Configuration format, \"hcl\" or \"json\". Detected from the file if not set.")
+	fs.Var(&c.Targets, "target", "Only process the named target. Can be repeated or comma-separated. Defaults to all targets.")
+	fs.Var(c.Vars, "var", "Set a configuration variable as name=value. Can be repeated.")
+	fs.Var(&c.VarFiles, "var-file", "Set configuration variables from an HCL or JSON file. Can be repeated.")
+	fs.BoolVar(&c.LegacyEnvVars, "legacy-env-vars", false, "Make environment variables available as top-level configuration variables as well as through env.")
+}
+
+// loadOptions returns the options for loading the configuration.
+func (c *configFlags) loadOptions() *config.LoadOptions {
+	return &config.LoadOptions{
+		Format:             c.Format,
+		Variables:          c.Vars,
+		VariableFiles:      c.VarFiles,
+		LegacyEnvVariables: c.LegacyEnvVars,
+	}
+}
+
+// stringSliceFlag is a flag.Value that collects repeated and
+// comma-separated values.
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(v string) error {
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*s = append(*s, part)
+		}
+	}
+
+	return nil
+}
+
+// repeatedFlag is a flag.Value that collects repeated values as is.
+type repeatedFlag []string
+
+func (s *repeatedFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *repeatedFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// varFlag is a flag.Value that collects repeated name=value pairs.
+type varFlag map[string]string
+
+func (v varFlag) String() string {
+	pairs := make([]string, 0, len(v))
+	for name, value := range v {
+		pairs = append(pairs, name+"="+value)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (v varFlag) Set(s string) error {
+	idx := strings.Index(s, "=")
+	if idx <= 0 {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+
+	v[strings.TrimSpace(s[:idx])] = s[idx+1:]
+	return nil
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/bi-zone/gon/notarize"
+	"github.com/bi-zone/gon/pipeline"
+	"github.com/bi-zone/gon/secret"
+)
+
+// output prints the pipeline events for human consumption. The pipeline
+// serializes the events so no locking is needed.
+type output struct {
+	// ctx is the context of the run. Once it is done, failures are
+	// expected and only reported in the summary.
+	ctx context.Context
+
+	// prefixes are the prefixes for the status output of each item.
+	prefixes map[*pipeline.Item]string
+
+	lastInfoStatus map[*pipeline.Item]string
+	lastLogStatus  map[*pipeline.Item]string
+
+	// stages are the signing and packaging stages seen so far, in order,
+	// with the kind of their last event.
+	stages []*stageStatus
+
+	// failed is true once a failure was reported by an event.
+	failed bool
+}
+
+// stageStatus is the status of a signing or packaging stage of a target.
+type stageStatus struct {
+	target string
+	stage  pipeline.Stage
+	path   string
+	kind   pipeline.EventKind
+}
+
+func newOutput(ctx context.Context) *output {
+	return &output{
+		ctx:            ctx,
+		prefixes:       map[*pipeline.Item]string{},
+		lastInfoStatus: map[*pipeline.Item]string{},
+		lastLogStatus:  map[*pipeline.Item]string{},
+	}
+}
+
+// unreported prints an error of the pipeline unless a failure event
+// already did, since the pipeline can fail before any stage, such as
+// when the state file can't be read.
+func (o *output) unreported(err error) {
+	if o.failed {
+		return
+	}
+	if diags, ok := err.(hcl.Diagnostics); ok {
+		printDiagnostics(diags)
+		return
+	}
+
+	fmt.Fprintf(os.Stdout, color.RedString("❗️ Error:\n\n%s\n", secret.Redact(err.Error())))
+}
+
+// Event implements the pipeline.Options.Events callback.
+func (o *output) Event(e pipeline.Event) {
+	if e.Kind == pipeline.EventFailed {
+		o.failed = true
+	}
+	if e.Item != nil {
+		o.itemEvent(e)
+		return
+	}
+	if e.Kind == pipeline.EventWarning {
+		color.New(color.FgYellow).Fprintf(os.Stdout, "    ⚠️  %s\n", e.Warning)
+		return
+	}
+	if e.Stage != "" && e.Stage != pipeline.StageNotarize {
+		o.track(e)
+	}
+
+	switch e.Kind {
+	case pipeline.EventTarget:
+		color.New(color.Bold).Fprintf(os.Stdout, "==> %s  Target %q\n", iconTarget, e.Target)
+		return
+
+	case pipeline.EventFailed:
+		if o.ctx.Err() != nil {
+			return
+		}
+
+		msg := secret.Redact(e.Err.Error())
+		switch e.Stage {
+		case pipeline.StageKeychain:
+			fmt.Fprintf(os.Stdout, color.RedString("❗️ Error creating temporary keychain:\n\n%s\n", msg))
+		case pipeline.StageSign:
+			fmt.Fprintf(os.Stdout, color.RedString("❗️ Error signing files:\n\n%s\n", msg))
+		case pipeline.StageZip:
+			fmt.Fprintf(os.Stdout, color.RedString("❗️ Error creating zip archive:\n\n%s\n", msg))
+		case pipeline.StageDmg:
+			fmt.Fprintf(os.Stdout, color.RedString("❗️ Error creating dmg:\n\n%s\n", msg))
+		case pipeline.StageSignDmg:
+			fmt.Fprintf(os.Stdout, color.RedString("❗️ Error signing dmg:\n\n%s\n", msg))
+		case pipeline.StageNotarize:
+			fmt.Fprintf(os.Stdout, color.RedString("\n❗️ Error notarizing:\n\n%s\n", msg))
+		}
+		return
+
+	case pipeline.EventSkipped:
+		o.skipped(e)
+		return
+	}
+
+	started := e.Kind == pipeline.EventStarted
+	switch e.Stage {
+	case pipeline.StageKeychain:
+		if started {
+			color.New(color.Bold).Fprintf(os.Stdout, "==> %s  Creating temporary keychain...\n", iconKeychain)
+		} else {
+			color.New().Fprintf(os.Stdout, "    Signing identity imported\n")
+		}
+
+	case pipeline.StageSign:
+		if started {
+			color.New(color.Bold).Fprintf(os.Stdout, "==> %s  Signing files...\n", iconSign)
+		} else {
+			color.New(color.Bold, color.FgGreen).Fprintf(os.Stdout, "    Code signing successful\n")
+		}
+
+	case pipeline.StageZip:
+		if started {
+			color.New(color.Bold).Fprintf(os.Stdout, "==> %s  Creating Zip archive...\n", iconPackage)
+		} else {
+			color.New(color.Bold, color.FgGreen).Fprintf(os.Stdout, "    Zip archive created with signed files\n")
+		}
+
+	case pipeline.StageDmg:
+		if started {
+			color.New(color.Bold).Fprintf(os.Stdout, "==> %s  Creating dmg...\n", iconPackage)
+			color.New().Fprintf(os.Stdout, "    This will open Finder windows momentarily.\n")
+		} else {
+			color.New().Fprintf(os.Stdout, "    Dmg file created: %s\n", e.Path)
+		}
+
+	case pipeline.StageSignDmg:
+		if started {
+			color.New().Fprintf(os.Stdout, "    Signing dmg...\n")
+		} else {
+			color.New(color.Bold, color.FgGreen).Fprintf(os.Stdout, "    Dmg created and signed\n")
+		}
+
+	case pipeline.StageNotarize:
+		if started {
+			color.New(color.Bold).Fprintf(os.Stdout, "==> %s  Notarizing...\n", iconNotarize)
+			if len(e.Items) > 1 {
+				color.New().Fprintf(os.Stdout, "    Files will be notarized concurrently to optimize queue wait\n")
+			}
+			for _, f := range e.Items {
+				color.New().Fprintf(os.Stdout, "    Path: %s\n", f.Path)
+			}
+
+			prefixes := statusPrefixList(e.Items)
+			for idx, f := range e.Items {
+				o.prefixes[f] = prefixes[idx]
+			}
+			return
+		}
+
+		// Success, output all the files that were notarized again to remind the user
+		color.New(color.Bold, color.FgGreen).Fprintf(os.Stdout, "\nNotarization complete! Notarized files:\n")
+		for _, f := range e.Items {
+			color.New(color.FgGreen).Fprintf(os.Stdout, "  - %s\n", f.String())
+		}
+	}
+}
+
+// skipped prints a stage that already finished in an earlier run.
+func (o *output) skipped(e pipeline.Event) {
+	switch e.Stage {
+	case pipeline.StageSign:
+		color.New(color.Bold).Fprintf(os.Stdout, "==> %s  Signing files...\n", iconSign)
+	case pipeline.StageZip:
+		color.New(color.Bold).Fprintf(os.Stdout, "==> %s  Creating Zip archive...\n", iconPackage)
+	case pipeline.StageDmg:
+		color.New(color.Bold).Fprintf(os.Stdout, "==> %s  Creating dmg...\n", iconPackage)
+	case pipeline.StageSignDmg:
+		color.New().Fprintf(os.Stdout, "    Signing dmg...\n")
+	}
+
+	color.New(color.FgGreen).Fprintf(os.Stdout, "    Already done in an earlier run, skipped\n")
+}
+
+// itemEvent prints the notarization and stapling events of an item.
+func (o *output) itemEvent(e pipeline.Event) {
+	prefix := o.prefixes[e.Item]
+
+	switch e.Stage {
+	case pipeline.StageNotarize:
+		switch e.Kind {
+		case pipeline.EventStarted:
+			color.New().Fprintf(os.Stdout, "    %sSubmitting file for notarization...\n", prefix)
+
+		case pipeline.EventSubmitted:
+			color.New().Fprintf(os.Stdout, "    %sSubmitted. Request UUID: %s\n", prefix, e.RequestUUID)
+			color.New().Fprintf(
+				os.Stdout, "    %sWaiting for results from Apple. This can take minutes to hours.\n", prefix)
+
+		case pipeline.EventInfoStatus:
+			if e.Info.Status != o.lastInfoStatus[e.Item] {
+				o.lastInfoStatus[e.Item] = e.Info.Status
+				color.New().Fprintf(os.Stdout, "    %sInfoStatus: %s\n", prefix, e.Info.Status)
+			}
+
+		case pipeline.EventLogStatus:
+			if e.Log.Status != o.lastLogStatus[e.Item] {
+				o.lastLogStatus[e.Item] = e.Log.Status
+				color.New().Fprintf(os.Stdout, "    %sLogStatus: %s\n", prefix, e.Log.Status)
+			}
+
+		case pipeline.EventFailed:
+			if o.ctx.Err() != nil {
+				return
+			}
+			color.New(color.FgRed).Fprintf(os.Stdout, "    %sError notarizing\n", prefix)
+			var invalid *notarize.InvalidError
+			if errors.As(e.Err, &invalid) && invalid.Log != nil {
+				printIssues(prefix, invalid.Log)
+			} else if hint := notarizeHint(e.Err); hint != "" {
+				color.New(color.FgYellow).Fprintf(os.Stdout, "    %s%s\n", prefix, hint)
+			}
+			o.logPath(prefix, e.Item)
+
+		case pipeline.EventFinished:
+			color.New(color.FgGreen).Fprintf(os.Stdout, "    %sFile notarized!\n", prefix)
+			o.logPath(prefix, e.Item)
+
+		case pipeline.EventSkipped:
+			color.New(color.FgGreen).Fprintf(os.Stdout, "    %sFile already notarized in an earlier run\n", prefix)
+		}
+
+	case pipeline.StageStaple:
+		switch e.Kind {
+		case pipeline.EventStarted:
+			color.New(color.Bold).Fprintf(os.Stdout, "    %sStapling...\n", prefix)
+
+		case pipeline.EventFailed:
+			if o.ctx.Err() != nil {
+				return
+			}
+			color.New(color.FgRed).Fprintf(os.Stdout, "    %sNotarization succeeded but stapling failed\n", prefix)
+
+		case pipeline.EventFinished:
+			color.New(color.FgGreen).Fprintf(os.Stdout, "    %sFile notarized and stapled!\n", prefix)
+
+		case pipeline.EventSkipped:
+			color.New(color.FgGreen).Fprintf(os.Stdout, "    %sFile already stapled in an earlier run\n", prefix)
+		}
+	}
+}
+
+// printIssues prints the issues of a notarization log grouped by the file
+// they are about, each with how to fix it if that's known.
+func printIssues(prefix string, log *notarize.Log) {
+	if log.StatusSummary != "" {
+		color.New(color.FgRed).Fprintf(os.Stdout, "    %s%s\n", prefix, log.StatusSummary)
+	}
+
+	for _, file := range log.IssuesByPath() {
+		color.New(color.Bold).Fprintf(os.Stdout, "    %s  %s\n", prefix, file.Path)
+		for _, issue := range file.Issues {
+			c := color.New(color.FgRed)
+			if issue.Severity != "error" {
+				c = color.New(color.FgYellow)
+			}
+			c.Fprintf(os.Stdout, "    %s    %s: %s\n", prefix, issue.Severity, issue.Message)
+			if remedy := issue.Remedy(); remedy != "" {
+				color.New(color.FgYellow).Fprintf(os.Stdout, "    %s      Fix: %s\n", prefix, remedy)
+			}
+		}
+	}
+}
+
+// logPath prints where the notarization log of the item was saved, if it
+// was.
+func (o *output) logPath(prefix string, item *pipeline.Item) {
+	if item.LogPath != "" {
+		color.New().Fprintf(os.Stdout, "    %sNotarization log saved: %s\n", prefix, item.LogPath)
+	}
+}
+
+// notarizeHint returns what to do about a notarization failure, empty if
+// there is nothing specific to suggest.
+func notarizeHint(err error) string {
+	switch {
+	case errors.Is(err, notarize.ErrTwoFactor):
+		return "Use an app-specific password, see the -22016 entry in Troubleshooting"
+	case errors.Is(err, notarize.ErrAuth):
+		return "Check the Apple ID credentials or the API key and its access"
+	case errors.Is(err, notarize.ErrNotFound):
+		return "Check that the request belongs to the team of the credentials"
+	case errors.Is(err, notarize.ErrRateLimited):
+		return "Too many requests, try a longer -poll-interval"
+	case errors.Is(err, notarize.ErrNetwork):
+		return "Apple's service couldn't be reached, try again with -resume"
+	case errors.Is(err, notarize.ErrInvalidPackage):
+		return "Only zip, dmg and pkg files can be notarized"
+	}
+
+	return ""
+}
+
+// track records the last event of a signing or packaging stage.
+func (o *output) track(e pipeline.Event) {
+	for _, s := range o.stages {
+		if s.target == e.Target && s.stage == e.Stage && s.path == e.Path {
+			s.kind = e.Kind
+			return
+		}
+	}
+
+	o.stages = append(o.stages, &stageStatus{
+		target: e.Target,
+		stage:  e.Stage,
+		path:   e.Path,
+		kind:   e.Kind,
+	})
+}
+
+// summary prints what was and wasn't finished by a run that was stopped
+// early. resume is true if the progress was saved and can be resumed.
+func (o *output) summary(result *pipeline.Result, resume bool) {
+	color.New(color.Bold, color.FgYellow).Fprintf(os.Stdout, "\n==> ⚠️  Stopped before finishing\n")
+
+	for _, s := range o.stages {
+		name := string(s.stage)
+		if s.target != "" {
+			name = fmt.Sprintf("[%s] %s", s.target, name)
+		}
+		if s.path != "" {
+			name += ": " + s.path
+		}
+
+		switch s.kind {
+		case pipeline.EventFinished, pipeline.EventSkipped:
+			color.New(color.FgGreen).Fprintf(os.Stdout, "    Done:        %s\n", name)
+		default:
+			color.New(color.FgRed).Fprintf(os.Stdout, "    Not done:    %s\n", name)
+		}
+	}
+
+	if result != nil {
+		for _, it := range result.Items {
+			switch {
+			case it.Notarized && (it.Stapled || !it.Staple):
+				color.New(color.FgGreen).Fprintf(os.Stdout, "    Done:        %s\n", it.String())
+			case it.Notarized:
+				color.New(color.FgRed).Fprintf(os.Stdout, "    Not stapled: %s\n", it.Path)
+			case it.RequestUUID != "":
+				color.New(color.FgYellow).Fprintf(os.Stdout, "    Pending:     %s (request UUID %s)\n", it.Path, it.RequestUUID)
+			default:
+				color.New(color.FgRed).Fprintf(os.Stdout, "    Not done:    %s (not submitted)\n", it.Path)
+			}
+		}
+	}
+
+	if resume {
+		color.New().Fprintf(os.Stdout, "\n    Run again with -resume to continue where this run stopped.\n")
+	}
+}
+
+// statusPrefixList takes a list of items and returns the prefixes to use
+// with status messages for each. The returned slice is guaranteed to be
+// allocated and the same length as items.
+func statusPrefixList(items []*pipeline.Item) []string {
+	// Special-case: for lists of one, we don't use any prefix at all.
+	if len(items) == 1 {
+		return []string{""}
+	}
+
+	// Create a list of basenames and also keep track of max length
+	result := make([]string, len(items))
+	max := 0
+	for idx, f := range items {
+		result[idx] = filepath.Base(f.Path)
+		if l := len(result[idx]); l > max {
+			max = l
+		}
+	}
+
+	// Pad all the strings to the max length
+	for idx, _ := range result {
+		result[idx] += strings.Repeat(" ", max-len(result[idx]))
+		result[idx] = fmt.Sprintf("[%s] ", result[idx])
+	}
+
+	return result
+}
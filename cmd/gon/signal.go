@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fatih/color"
+)
+
+// interruptContext returns a context that is cancelled on the first
+// SIGINT or SIGTERM, so the running commands are stopped and the progress
+// so far can be reported. A second signal kills gon right away. The
+// returned function must be called to release the signal handler.
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-ch:
+			// Restore the default behavior for the next signal
+			signal.Stop(ch)
+
+			color.New(color.Bold, color.FgYellow).Fprintf(os.Stdout,
+				"\n⚠️  Received %s, stopping. Signal again to quit immediately.\n", sig)
+			cancel()
+
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(ch)
+		cancel()
+	}
+}
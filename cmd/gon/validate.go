@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/bi-zone/gon/config"
+)
+
+// validateMain is the entrypoint of "gon validate". It loads and validates
+// the configuration without signing or notarizing anything.
+func validateMain(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	dontNotarize := flags.Bool("dont-notarize", false, "Don't validate the settings only needed for notarization.")
+	var cfgFlags configFlags
+	cfgFlags.register(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stdout, strings.TrimSpace(validateHelp)+"\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	args = flags.Args()
+
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stdout, color.RedString("❗️ Path to configuration expected.\n\n"))
+		flags.Usage()
+		return 1
+	}
+
+	cfg, diags := loadConfig(args[0], cfgFlags.loadOptions())
+	if !diags.HasErrors() {
+		diags = append(diags, config.Validate(cfg, &config.ValidateOptions{
+			Targets:      cfgFlags.Targets,
+			DontNotarize: *dontNotarize,
+		})...)
+	}
+
+	printDiagnostics(diags)
+	if diags.HasErrors() {
+		return 1
+	}
+
+	color.New(color.Bold, color.FgGreen).Fprintf(os.Stdout, "The configuration is valid.\n")
+	return 0
+}
+
+// printDiagnostics prints errors and warnings for the user.
+func printDiagnostics(diags hcl.Diagnostics) {
+	for _, diag := range diags {
+		icon, c := "❗️", color.FgRed
+		if diag.Severity == hcl.DiagWarning {
+			icon, c = "⚠️ ", color.FgYellow
+		}
+
+		color.New(color.Bold, c).Fprintf(os.Stdout, "%s %s\n", icon, diag.Summary)
+		if diag.Subject != nil {
+			color.New(c).Fprintf(os.Stdout, "  on %s\n", diag.Subject)
+		}
+		if diag.Detail != "" {
+			color.New(c).Fprintf(os.Stdout, "%s\n", diag.Detail)
+		}
+		fmt.Fprintln(os.Stdout)
+	}
+}
+
+const validateHelp = `
+Validate a gon configuration without signing or notarizing anything.
+
+Usage: %[1]s validate [flags] CONFIG
+
+Reports any errors in the configuration with the file and line they're at,
+and exits with a non-zero status if there are any. The apple_id settings are
+validated with the same environment variable defaults as a normal run.
+
+Flags:
+`
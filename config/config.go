@@ -0,0 +1,453 @@
+// Package config parses and validates gon configuration files.
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config is the configuration structure for gon.
+type Config struct {
+	// Source is the list of binary files to sign.
+	Source []string `hcl:"source,optional"`
+
+	// BundleId is the bundle ID to use for the package that is created.
+	// This should be in a format such as "com.example.app". The value can
+	// be anything, this is required by Apple.
+	BundleId string `hcl:"bundle_id,optional"`
+
+	// Notarize is a single file (usually a .pkg installer or zip)
+	// that is ready for notarization as-is
+	Notarize []Notarize `hcl:"notarize,block"`
+
+	// Sign are the settings for code-signing the binaries.
+	Sign *Sign `hcl:"sign,block"`
+
+	// AppleId are the credentials to use to talk to Apple.
+	AppleId *AppleId `hcl:"apple_id,block"`
+
+	// Zip, if present, creates a notarized zip file as the output. Note
+	// that zip files do not support stapling, so the final result will
+	// require an internet connection on first use to validate the notarization.
+	Zip *Zip `hcl:"zip,block"`
+
+	// Dmg, if present, creates a dmg file to package the signed `Source` files
+	// into. Dmg files support stapling so this allows offline usage.
+	Dmg *Dmg `hcl:"dmg,block"`
+
+	// Target are named sets of files that are signed, packaged and
+	// notarized with their own settings. This lets a single configuration
+	// use different identities or packages for different files. The
+	// top-level BundleId and AppleId are used as defaults for all targets.
+	Target []Target `hcl:"target,block"`
+
+	// Timeouts, if present, limit how long processing may take.
+	Timeouts *Timeouts `hcl:"timeouts,block"`
+
+	// Keychain, if present, imports the signing identity into a temporary
+	// keychain for the signing stages of all targets.
+	Keychain *Keychain `hcl:"keychain,block"`
+
+	// src is where the configuration was defined, if loaded from a file.
+	src *source
+}
+
+// Target is a named set of files to sign, package and notarize. The
+// fields have the same meaning as the equivalent top-level fields in Config.
+type Target struct {
+	// Name is the name of the target used to select it on the CLI.
+	Name string `hcl:"name,label"`
+
+	Source   []string   `hcl:"source,optional"`
+	BundleId string     `hcl:"bundle_id,optional"`
+	Notarize []Notarize `hcl:"notarize,block"`
+	Sign     *Sign      `hcl:"sign,block"`
+	Zip      *Zip       `hcl:"zip,block"`
+	Dmg      *Dmg       `hcl:"dmg,block"`
+
+	// AppleId, if set, replaces the top-level apple_id block for this
+	// target. The block isn't merged with the top-level one.
+	AppleId *AppleId `hcl:"apple_id,block"`
+
+	// src is where the target was defined, if loaded from a file.
+	src *source
+}
+
+// Targets returns all the targets of the configuration with the top-level
+// defaults applied. The top-level source, notarize, sign, zip and dmg
+// settings form an unnamed target that comes first. It is omitted if
+// none of these are set and there are named targets.
+//
+// The returned targets are copies, but AppleId is shared with the
+// configuration if a target doesn't set its own.
+func (c *Config) Targets() []*Target {
+	var result []*Target
+
+	root := &Target{
+		Source:   c.Source,
+		BundleId: c.BundleId,
+		Notarize: c.Notarize,
+		Sign:     c.Sign,
+		Zip:      c.Zip,
+		Dmg:      c.Dmg,
+		AppleId:  c.AppleId,
+		src:      c.src,
+	}
+	if len(c.Target) == 0 || !root.empty() {
+		result = append(result, root)
+	}
+
+	for _, t := range c.Target {
+		t := t
+		if t.BundleId == "" {
+			t.BundleId = c.BundleId
+		}
+		if t.AppleId == nil {
+			t.AppleId = c.AppleId
+		}
+
+		result = append(result, &t)
+	}
+
+	return result
+}
+
+// SelectTargets returns the targets to process, see Targets. If names is
+// empty all targets are returned, otherwise only the named ones in the
+// order they appear in the configuration.
+func (c *Config) SelectTargets(names []string) ([]*Target, error) {
+	all := c.Targets()
+
+	seen := map[string]bool{}
+	for _, t := range all {
+		if t.Name == "" {
+			continue
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("Target %q is defined more than once", t.Name)
+		}
+		seen[t.Name] = true
+	}
+
+	if len(names) == 0 {
+		return all, nil
+	}
+
+	wanted := map[string]bool{}
+	for _, n := range names {
+		if !seen[n] {
+			return nil, fmt.Errorf("Unknown target %q", n)
+		}
+		wanted[n] = true
+	}
+
+	var result []*Target
+	for _, t := range all {
+		if wanted[t.Name] {
+			result = append(result, t)
+		}
+	}
+
+	return result, nil
+}
+
+// empty returns true if the target has nothing to process.
+func (t *Target) empty() bool {
+	return len(t.Source) == 0 && len(t.Notarize) == 0 &&
+		t.Sign == nil && t.Zip == nil && t.Dmg == nil
+}
+
+// AppleId are the authentication settings for Apple systems.
+type AppleId struct {
+	// Username is your AC username, typically an email. This is required, but will
+	// be read from the environment via AC_USERNAME if not specified via config.
+	Username string `hcl:"username,optional"`
+
+	// Password is the password for your AC account. This also accepts
+	// three additional forms: '@keychain:<name>' which reads the password from
+	// the keychain, '@env:<name>' which reads the password from an
+	// environmental variable named <name> and '@file:<path>' which reads the
+	// password from the file at <path>. If omitted, it has the same effect
+	// as passing '@env:AC_PASSWORD'.
+	Password string `hcl:"password,optional"`
+
+	// ApiKey is the name (ID) of an API key generated on App Store Connect portal.
+	//
+	// You must specify either Username and Password or ApiKey and ApiIssuer.
+	// API authorization takes precedence over the username+password one.
+	//
+	// If omitted will be set from environment via AC_APIKEY.
+	ApiKey string `hcl:"api_key,optional"`
+
+	// ApiKeyPath specifies an exact path to the API key file in a `.p8` format.
+	//
+	// If omitted, `gon` will search for an 'AuthKey_<api_key>.p8' file in a one of the
+	// following directories './private_keys', '~/private_keys', '~/.private_keys',
+	// '~/.appstoreconnect/private_keys' or in dir specified via API_PRIVATE_KEYS_DIR env.
+	ApiKeyPath string `hcl:"api_key_path,optional"`
+
+	// ApiKeyContent is the content of the `.p8` key file, as is or base64
+	// encoded, for keys that aren't on disk such as CI secrets. It's only
+	// used if ApiKeyPath isn't set. gon writes it to a temporary file that
+	// only the user can read while notarizing and removes it afterwards.
+	//
+	// If omitted will be set from environment via AC_APIKEY_CONTENT.
+	ApiKeyContent string `hcl:"api_key_content,optional"`
+
+	// ApiIssuer is the ID of the specified ApiKey Issuer. Required if ApiKey is specified.
+	//
+	// If omitted will be set from environment via AC_APIISSUER.
+	ApiIssuer string `hcl:"api_issuer,optional"`
+
+	// Provider is the AC provider. This is optional and only needs to be
+	// specified if you're using an Apple ID account that has multiple
+	// teams.
+	//
+	// If omitted will be set from environment via AC_PROVIDER, or else
+	// from the team ID of the signing identity if files are signed.
+	Provider string `hcl:"provider,optional"`
+
+	// KeychainProfile is the name of a notarytool keychain profile holding
+	// the credentials, as created by `gon store-credentials` or
+	// `notarytool store-credentials`. It takes precedence over the other
+	// settings, which are only needed to create the profile.
+	//
+	// If omitted will be set from environment via AC_KEYCHAIN_PROFILE.
+	KeychainProfile string `hcl:"keychain_profile,optional"`
+
+	// src is where the block was defined, if loaded from a file.
+	src *source
+}
+
+// Notarize are the options for notarizing a pre-built file.
+type Notarize struct {
+	// Path is the path to the file to notarize. This can be any supported
+	// filetype (dmg, pkg, app, zip).
+	Path string `hcl:"path"`
+
+	// BundleId is the bundle ID to use for notarizing this package.
+	// If this isn't specified then the root bundle_id is inherited.
+	BundleId string `hcl:"bundle_id"`
+
+	// Staple, if true will staple the notarization ticket to the file.
+	Staple bool `hcl:"staple,optional"`
+}
+
+// Sign are the options for codesigning the binaries.
+type Sign struct {
+	// ApplicationIdentity is the ID or name of the certificate to
+	// use for signing binaries. This is used for all binaries in "source".
+	// If empty, the single "Developer ID Application" identity in the
+	// keychain is used.
+	ApplicationIdentity string `hcl:"application_identity,optional"`
+
+	// Specify a path to an entitlements file in plist format
+	EntitlementsFile string `hcl:"entitlements_file,optional"`
+
+	// Identifier is the code signing identifier of the source files. It
+	// defaults to the bundle ID if there is a single source file.
+	Identifier string `hcl:"identifier,optional"`
+
+	// Prefix is the prefix of identifiers that codesign derives from file
+	// names, such as "com.example.".
+	Prefix string `hcl:"prefix,optional"`
+
+	// Keychain is the path of the keychain to find the identity in. It
+	// defaults to the temporary keychain, if any, and otherwise to the
+	// keychain search list.
+	Keychain string `hcl:"keychain,optional"`
+
+	// Timestamp is the URL of the time-stamping server, or "none" to not
+	// time-stamp the signatures. Apple's server is used if empty, which
+	// notarization requires.
+	Timestamp string `hcl:"timestamp,optional"`
+
+	// Options are code signing flags to set in addition to the hardened
+	// runtime, such as "library" or "kill".
+	Options []string `hcl:"options,optional"`
+
+	// PreserveMetadata are the kinds of metadata of existing signatures to
+	// keep, such as "entitlements" or "requirements".
+	PreserveMetadata []string `hcl:"preserve_metadata,optional"`
+
+	// StripDisallowedXattrs, if true, removes the extended attributes that
+	// would make signing fail.
+	StripDisallowedXattrs bool `hcl:"strip_disallowed_xattrs,optional"`
+
+	// ExtraArgs are passed to codesign as is, before the files.
+	ExtraArgs []string `hcl:"extra_args,optional"`
+
+	// Rule are settings for some of the source files, such as helper tools
+	// that need other entitlements than the main binary. Each file is
+	// signed with the first rule that matches it, or the settings above if
+	// none does.
+	Rule []SignRule `hcl:"rule,block"`
+
+	// Deep, if true, signs the code nested in the app bundles and
+	// frameworks in "source" before the bundles, inside out, such as
+	// frameworks, helper tools and XPC services. Rules can match the paths
+	// of the nested code.
+	Deep bool `hcl:"deep,optional"`
+
+	// ExpiryWarning and ExpiryError are how long before the certificate of
+	// the identity expires signing warns and fails. The values are
+	// durations such as "720h". The warning defaults to
+	// DefaultExpiryWarning and "0s" disables it. An expired certificate
+	// always fails.
+	ExpiryWarning string `hcl:"expiry_warning,optional"`
+	ExpiryError   string `hcl:"expiry_error,optional"`
+}
+
+// SignRule are the signing settings of the source files matching one of
+// its paths. The entitlements, identifier and options replace those of the
+// sign block even if they aren't set, the other settings are shared.
+type SignRule struct {
+	// Paths are the source files the rule applies to, as paths or glob
+	// patterns such as "./bin/helper-*".
+	Paths []string `hcl:"paths"`
+
+	// ApplicationIdentity is the identity to sign the files with. It
+	// defaults to the identity of the sign block.
+	ApplicationIdentity string `hcl:"application_identity,optional"`
+
+	EntitlementsFile string   `hcl:"entitlements_file,optional"`
+	Identifier       string   `hcl:"identifier,optional"`
+	Options          []string `hcl:"options,optional"`
+}
+
+// DefaultExpiryWarning is the default of Sign.ExpiryWarning, 30 days.
+const DefaultExpiryWarning = "720h"
+
+// Expiry returns the parsed expiry settings with the defaults applied.
+// Use Validate to report invalid values.
+func (s *Sign) Expiry() (warning, fail time.Duration, err error) {
+	value := s.ExpiryWarning
+	if value == "" {
+		value = DefaultExpiryWarning
+	}
+	if warning, err = parseExpiry(value); err != nil {
+		return 0, 0, fmt.Errorf("invalid expiry warning: %w", err)
+	}
+	if fail, err = parseExpiry(s.ExpiryError); err != nil {
+		return 0, 0, fmt.Errorf("invalid expiry error: %w", err)
+	}
+
+	return warning, fail, nil
+}
+
+// parseExpiry parses an expiry setting. An empty value is zero.
+func parseExpiry(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration must not be negative")
+	}
+
+	return d, nil
+}
+
+// Dmg are the options for a dmg file as output.
+type Dmg struct {
+	// OutputPath is the path where the final dmg will be saved.
+	OutputPath string `hcl:"output_path"`
+
+	// Volume name is the name of the volume that shows up in the title
+	// and sidebar after opening it.
+	VolumeName string `hcl:"volume_name"`
+
+	// SkipPrettification disables running of prettification logic of `create-dmg`.
+	// The logic itself is relied on AppleScript and could be faulty on CI or restricted env.
+	//
+	// N.B. Enabling this option will make opened `.dmg` in finder less pretty than before.
+	SkipPrettification bool `hcl:"skip_prettification,optional"`
+}
+
+// Zip are the options for a zip file as output.
+type Zip struct {
+	// OutputPath is the path where the final zip file will be saved.
+	OutputPath string `hcl:"output_path"`
+}
+
+// Keychain are the settings for a temporary keychain the signing identity
+// is imported into, for machines such as CI runners that don't have it in
+// their keychains. The keychain is deleted once signing is done.
+type Keychain struct {
+	// P12Path is the path to the .p12 file holding the certificate and the
+	// private key of the signing identity.
+	P12Path string `hcl:"p12_path,optional"`
+
+	// P12Content is the base64 encoded content of the .p12 file. It
+	// accepts the same '@env:<name>', '@keychain:<name>' and '@file:<path>'
+	// references as the apple_id password. Exactly one of P12Path and
+	// P12Content must be set.
+	P12Content string `hcl:"p12_content,optional"`
+
+	// Password is the password of the .p12 file. It accepts the same
+	// references as P12Content.
+	Password string `hcl:"password,optional"`
+
+	// src is where the block was defined, if loaded from a file.
+	src *source
+}
+
+// Timeouts are the time limits for processing a configuration. The values
+// are durations such as "90s", "30m" or "1h30m". Unset values don't limit
+// anything.
+type Timeouts struct {
+	// Total limits the whole run, across all targets.
+	Total string `hcl:"total,optional"`
+
+	// Notarize limits the notarization of each file, from the upload until
+	// Apple's result is in. Stapling isn't included.
+	Notarize string `hcl:"notarize,optional"`
+
+	// Command limits each execution of codesign, ditto, create-dmg,
+	// notarytool and stapler.
+	Command string `hcl:"command,optional"`
+
+	// src is where the block was defined, if loaded from a file.
+	src *source
+}
+
+// Durations returns the parsed timeouts, zero for those that aren't set.
+// The receiver may be nil. Use Validate to report invalid values.
+func (t *Timeouts) Durations() (total, notarize, command time.Duration, err error) {
+	if t == nil {
+		return 0, 0, 0, nil
+	}
+
+	if total, err = parseTimeout(t.Total); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid total timeout: %w", err)
+	}
+	if notarize, err = parseTimeout(t.Notarize); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid notarize timeout: %w", err)
+	}
+	if command, err = parseTimeout(t.Command); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid command timeout: %w", err)
+	}
+
+	return total, notarize, command, nil
+}
+
+// parseTimeout parses a timeout setting. An empty value is zero.
+func parseTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("timeout must be positive")
+	}
+
+	return d, nil
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigTargets(t *testing.T) {
+	require := require.New(t)
+
+	cfg, err := ParseFile(filepath.Join("testdata", "targets.hcl"))
+	require.NoError(err)
+
+	targets := cfg.Targets()
+	require.Len(targets, 2)
+
+	app := targets[0]
+	require.Equal("app", app.Name)
+	require.Equal("com.example.app", app.BundleId)
+	require.True(app.AppleId == cfg.AppleId, "app should share the top-level apple_id")
+
+	helper := targets[1]
+	require.Equal("helper", helper.Name)
+	require.Equal("com.example.helper", helper.BundleId)
+	require.Equal("ABCDEF1234", helper.AppleId.ApiKey)
+	require.Empty(helper.AppleId.Username)
+
+	// Defaults must not leak back into the configuration
+	require.Empty(cfg.Target[0].BundleId)
+}
+
+func TestConfigTargets_root(t *testing.T) {
+	require := require.New(t)
+
+	// Without named targets the top-level settings are the only target,
+	// even if empty.
+	cfg := &Config{}
+	targets := cfg.Targets()
+	require.Len(targets, 1)
+	require.Empty(targets[0].Name)
+
+	// With named targets the top-level target is only kept if it has
+	// something to do.
+	cfg = &Config{
+		Source: []string{"foo"},
+		Target: []Target{{Name: "bar"}},
+	}
+	targets = cfg.Targets()
+	require.Len(targets, 2)
+	require.Empty(targets[0].Name)
+	require.Equal([]string{"foo"}, targets[0].Source)
+	require.Equal("bar", targets[1].Name)
+}
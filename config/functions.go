@@ -0,0 +1,233 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// functions returns the functions available in configuration expressions.
+// now is the value returned by timestamp() so that it is stable across a
+// single configuration.
+//
+// Relative paths given to the filesystem functions are resolved from the
+// working directory, the same as the paths in `source`.
+func functions(now time.Time) map[string]function.Function {
+	return map[string]function.Function{
+		// cty standard library
+		"abs":        stdlib.AbsoluteFunc,
+		"coalesce":   stdlib.CoalesceFunc,
+		"concat":     stdlib.ConcatFunc,
+		"csvdecode":  stdlib.CSVDecodeFunc,
+		"format":     stdlib.FormatFunc,
+		"formatdate": stdlib.FormatDateFunc,
+		"formatlist": stdlib.FormatListFunc,
+		"int":        stdlib.IntFunc,
+		"jsondecode": stdlib.JSONDecodeFunc,
+		"jsonencode": stdlib.JSONEncodeFunc,
+		"length":     stdlib.LengthFunc,
+		"lower":      stdlib.LowerFunc,
+		"max":        stdlib.MaxFunc,
+		"min":        stdlib.MinFunc,
+		"range":      stdlib.RangeFunc,
+		"regex":      stdlib.RegexFunc,
+		"regexall":   stdlib.RegexAllFunc,
+		"reverse":    stdlib.ReverseFunc,
+		"setunion":   stdlib.SetUnionFunc,
+		"strlen":     stdlib.StrlenFunc,
+		"substr":     stdlib.SubstrFunc,
+		"upper":      stdlib.UpperFunc,
+
+		// strings
+		"join":      joinFunc,
+		"split":     splitFunc,
+		"replace":   replaceFunc,
+		"trimspace": trimSpaceFunc,
+		"sha256":    sha256Func,
+		"timestamp": timestampFunc(now),
+
+		// filesystem
+		"abspath":    abspathFunc,
+		"basename":   basenameFunc,
+		"dirname":    dirnameFunc,
+		"file":       fileFunc,
+		"fileexists": fileExistsFunc,
+		"glob":       globFunc,
+	}
+}
+
+// joinFunc concatenates the elements of one or more lists of strings
+// with a separator: join(sep, list...).
+var joinFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "separator", Type: cty.String},
+	},
+	VarParam: &function.Parameter{
+		Name: "lists",
+		Type: cty.List(cty.String),
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		var parts []string
+		for _, list := range args[1:] {
+			var elems []string
+			if err := gocty.FromCtyValue(list, &elems); err != nil {
+				return cty.UnknownVal(cty.String), err
+			}
+			parts = append(parts, elems...)
+		}
+
+		return cty.StringVal(strings.Join(parts, args[0].AsString())), nil
+	},
+})
+
+// splitFunc splits a string into a list of strings: split(sep, str).
+var splitFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "separator", Type: cty.String},
+		{Name: "str", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.List(cty.String)),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return stringList(strings.Split(args[1].AsString(), args[0].AsString())), nil
+	},
+})
+
+// replaceFunc replaces all occurrences of a substring: replace(str, old, new).
+var replaceFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "str", Type: cty.String},
+		{Name: "substr", Type: cty.String},
+		{Name: "replace", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(strings.Replace(
+			args[0].AsString(), args[1].AsString(), args[2].AsString(), -1)), nil
+	},
+})
+
+var trimSpaceFunc = stringFunc(strings.TrimSpace)
+
+// sha256Func returns the hex encoded SHA-256 of a string.
+var sha256Func = stringFunc(func(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+})
+
+// timestampFunc returns a function that returns now in RFC 3339 format.
+func timestampFunc(now time.Time) function.Function {
+	return function.New(&function.Spec{
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.StringVal(now.UTC().Format(time.RFC3339)), nil
+		},
+	})
+}
+
+var abspathFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "path", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		path, err := filepath.Abs(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		return cty.StringVal(path), nil
+	},
+})
+
+var basenameFunc = stringFunc(filepath.Base)
+var dirnameFunc = stringFunc(filepath.Dir)
+
+// fileFunc returns the contents of a file as a string.
+var fileFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "path", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		raw, err := ioutil.ReadFile(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		return cty.StringVal(string(raw)), nil
+	},
+})
+
+// fileExistsFunc returns true if a regular file exists at the path.
+var fileExistsFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "path", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		fi, err := os.Stat(args[0].AsString())
+		if os.IsNotExist(err) {
+			return cty.False, nil
+		}
+		if err != nil {
+			return cty.UnknownVal(cty.Bool), err
+		}
+
+		return cty.BoolVal(fi.Mode().IsRegular()), nil
+	},
+})
+
+// globFunc returns the sorted list of paths matching a pattern.
+var globFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "pattern", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.List(cty.String)),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		matches, err := filepath.Glob(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.List(cty.String)), err
+		}
+
+		sort.Strings(matches)
+		return stringList(matches), nil
+	},
+})
+
+// stringFunc wraps a func(string) string as a function.
+func stringFunc(f func(string) string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "str", Type: cty.String},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.StringVal(f(args[0].AsString())), nil
+		},
+	})
+}
+
+// stringList converts a slice of strings into a cty list.
+func stringList(list []string) cty.Value {
+	if len(list) == 0 {
+		return cty.ListValEmpty(cty.String)
+	}
+
+	vals := make([]cty.Value, len(list))
+	for i, s := range list {
+		vals[i] = cty.StringVal(s)
+	}
+
+	return cty.ListVal(vals)
+}
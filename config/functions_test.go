@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestFunctions(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.zip", "a.zip", "c.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("hello"), 0644))
+	}
+
+	now := time.Date(2023, 8, 1, 8, 22, 19, 0, time.FixedZone("X", 3600))
+	funcs := functions(now)
+
+	cases := []struct {
+		Name   string
+		Args   []cty.Value
+		Result cty.Value
+	}{
+		{
+			"join",
+			[]cty.Value{
+				cty.StringVal("-"),
+				cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+				cty.ListVal([]cty.Value{cty.StringVal("c")}),
+			},
+			cty.StringVal("a-b-c"),
+		},
+		{
+			"split",
+			[]cty.Value{cty.StringVal(","), cty.StringVal("a,b")},
+			cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		},
+		{
+			"replace",
+			[]cty.Value{cty.StringVal("a.b.c"), cty.StringVal("."), cty.StringVal("/")},
+			cty.StringVal("a/b/c"),
+		},
+		{
+			"sha256",
+			[]cty.Value{cty.StringVal("hello")},
+			cty.StringVal("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"),
+		},
+		{
+			"timestamp",
+			nil,
+			cty.StringVal("2023-08-01T07:22:19Z"),
+		},
+		{
+			"file",
+			[]cty.Value{cty.StringVal(filepath.Join(dir, "a.zip"))},
+			cty.StringVal("hello"),
+		},
+		{
+			"fileexists",
+			[]cty.Value{cty.StringVal(filepath.Join(dir, "nope"))},
+			cty.False,
+		},
+		{
+			"glob",
+			[]cty.Value{cty.StringVal(filepath.Join(dir, "*.zip"))},
+			cty.ListVal([]cty.Value{
+				cty.StringVal(filepath.Join(dir, "a.zip")),
+				cty.StringVal(filepath.Join(dir, "b.zip")),
+			}),
+		},
+		{
+			"glob",
+			[]cty.Value{cty.StringVal(filepath.Join(dir, "*.pkg"))},
+			cty.ListValEmpty(cty.String),
+		},
+		{
+			"basename",
+			[]cty.Value{cty.StringVal("/path/to/gon.zip")},
+			cty.StringVal("gon.zip"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			result, err := funcs[tc.Name].Call(tc.Args)
+			require.NoError(t, err)
+			require.True(t, tc.Result.RawEquals(result), "got %#v", result)
+		})
+	}
+}
@@ -0,0 +1,369 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/dynblock"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Supported configuration formats for Parse.
+const (
+	FormatHCL  = "hcl"
+	FormatJSON = "json"
+)
+
+// ParseFile parses the given file for a configuration. The syntax of the
+// file is determined based on the filename extension: "hcl" for HCL,
+// "json" for JSON. For any other extension the syntax is detected from
+// the contents, see Parse.
+func ParseFile(filename string) (*Config, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f, filename, "")
+}
+
+// Parse parses the configuration from the given reader. The reader will be
+// read to completion (EOF) before returning so ensure that the reader
+// does not block forever.
+//
+// filename is only used for diagnostics and for detecting the format.
+//
+// format is either "hcl" or "json". If it is empty, the format is taken
+// from the filename extension and, failing that, detected from the
+// contents: anything starting with "{" is treated as JSON.
+//
+// Parse uses the default LoadOptions and drops any warnings. Use Load
+// to set variables or to get the warnings.
+func Parse(r io.Reader, filename, format string) (*Config, error) {
+	cfg, diags := Load(r, filename, &LoadOptions{Format: format})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return cfg, nil
+}
+
+// LoadOptions are the options for Load.
+type LoadOptions struct {
+	// Format is the configuration format, see Parse.
+	Format string
+
+	// Variables are the values for variables declared with `variable`
+	// blocks, e.g. from the -var flag. These override the values from
+	// VariableFiles.
+	Variables map[string]string
+
+	// VariableFiles are paths to HCL or JSON files that set values for
+	// declared variables as top-level attributes, e.g. from the -var-file
+	// flag. Later files override earlier ones.
+	VariableFiles []string
+
+	// LegacyEnvVariables makes every environment variable available as a
+	// top-level variable as well as through `env`. This is how earlier
+	// versions of gon behaved. Note that names such as PATH can collide
+	// with other variables.
+	LegacyEnvVariables bool
+}
+
+// Load parses the configuration from the given reader, the same as Parse.
+// The returned diagnostics contain both errors and warnings such as values
+// given for undeclared variables or, with LegacyEnvVariables, references
+// to environment variables that aren't through env. The configuration is
+// nil if the diagnostics have errors.
+func Load(r io.Reader, filename string, opts *LoadOptions) (*Config, hcl.Diagnostics) {
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read configuration",
+			Detail:   fmt.Sprintf("Failed to read %s: %s.", filename, err),
+		}}
+	}
+
+	file, diags := parseSource(hclparse.NewParser(), src, filename, opts.Format)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	ctx := evalContext(opts.LegacyEnvVariables)
+	if opts.LegacyEnvVariables {
+		diags = append(diags, warnEnvReferences(file.Body, ctx)...)
+	}
+
+	// Variables and locals are evaluated first so everything else can
+	// refer to them.
+	content, remain, contentDiags := file.Body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "variable", LabelNames: []string{"name"}},
+			{Type: "locals"},
+		},
+	})
+	diags = append(diags, contentDiags...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	var variables, locals hcl.Blocks
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case "variable":
+			variables = append(variables, block)
+		case "locals":
+			locals = append(locals, block)
+		}
+	}
+
+	diags = append(diags, decodeVariables(variables, ctx, opts)...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	diags = append(diags, decodeLocals(locals, ctx)...)
+	if diags.HasErrors() {
+		return nil, hintEnvVariables(diags, opts)
+	}
+
+	var config Config
+	body := dynblock.Expand(remain, ctx)
+	diags = append(diags, gohcl.DecodeBody(body, ctx, &config)...)
+	if diags.HasErrors() {
+		return nil, hintEnvVariables(diags, opts)
+	}
+	recordSources(body, &config)
+
+	return &config, diags
+}
+
+// parseSource parses src in the given format, detecting the format if
+// it's empty.
+func parseSource(parser *hclparse.Parser, src []byte, filename, format string) (*hcl.File, hcl.Diagnostics) {
+	if format == "" {
+		format = detectFormat(filename, src)
+	}
+
+	switch format {
+	case FormatHCL:
+		return parser.ParseHCL(src, filename)
+	case FormatJSON:
+		return parser.ParseJSON(src, filename)
+	default:
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported configuration format",
+			Detail: fmt.Sprintf("The format %q is not supported, it must be %q or %q.",
+				format, FormatHCL, FormatJSON),
+		}}
+	}
+}
+
+// decodeLocals evaluates the attributes of all the locals blocks and adds
+// them to ctx as the "local" object. Locals may refer to each other in any
+// order as long as there is no cycle.
+func decodeLocals(blocks hcl.Blocks, ctx *hcl.EvalContext) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	pending := map[string]*hcl.Attribute{}
+	for _, block := range blocks {
+		attrs, attrDiags := block.Body.JustAttributes()
+		diags = append(diags, attrDiags...)
+		for name, attr := range attrs {
+			if prev, ok := pending[name]; ok {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate local value",
+					Detail: fmt.Sprintf("A local value named %q was already defined at %s.",
+						name, prev.NameRange),
+					Subject: attr.NameRange.Ptr(),
+				})
+				continue
+			}
+
+			pending[name] = attr
+		}
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+
+	values := map[string]cty.Value{}
+	for len(pending) > 0 {
+		// Sort so that diagnostics come out in a stable order
+		names := make([]string, 0, len(pending))
+		for name := range pending {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		progress := false
+		for _, name := range names {
+			attr := pending[name]
+			if dependsOnLocals(attr, pending) {
+				continue
+			}
+
+			ctx.Variables["local"] = cty.ObjectVal(values)
+			v, valDiags := attr.Expr.Value(ctx)
+			diags = append(diags, valDiags...)
+			values[name] = v
+			delete(pending, name)
+			progress = true
+		}
+
+		if !progress {
+			for _, name := range names {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Cycle in local values",
+					Detail: fmt.Sprintf(
+						"The local value %q depends on itself through other local values.", name),
+					Subject: pending[name].Expr.Range().Ptr(),
+				})
+			}
+
+			return diags
+		}
+	}
+
+	ctx.Variables["local"] = cty.ObjectVal(values)
+	return diags
+}
+
+// dependsOnLocals returns true if the attribute refers to any of the
+// given local values that aren't evaluated yet.
+func dependsOnLocals(attr *hcl.Attribute, pending map[string]*hcl.Attribute) bool {
+	for _, traversal := range attr.Expr.Variables() {
+		if traversal.RootName() != "local" || len(traversal) < 2 {
+			continue
+		}
+
+		if step, ok := traversal[1].(hcl.TraverseAttr); ok && pending[step.Name] != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// detectFormat returns the format of the configuration based on the
+// filename extension or, if that doesn't tell, the contents.
+func detectFormat(filename string, src []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".hcl":
+		return FormatHCL
+	case ".json":
+		return FormatJSON
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(src), []byte("{")) {
+		return FormatJSON
+	}
+
+	return FormatHCL
+}
+
+// evalContext returns the base context for evaluating the configuration.
+// It has the functions and the environment variables as the "env" object.
+// With legacy set the environment variables are also top-level variables.
+func evalContext(legacy bool) *hcl.EvalContext {
+	ctx := hcl.EvalContext{
+		Variables: make(map[string]cty.Value),
+		Functions: functions(time.Now()),
+	}
+
+	env := map[string]cty.Value{}
+	for _, e := range os.Environ() {
+		pair := strings.SplitN(e, "=", 2)
+		env[pair[0]] = cty.StringVal(pair[1])
+		if legacy {
+			ctx.Variables[pair[0]] = cty.StringVal(pair[1])
+		}
+	}
+	ctx.Variables["env"] = cty.ObjectVal(env)
+
+	return &ctx
+}
+
+// warnEnvReferences returns a warning for each reference to an undeclared
+// top-level variable that only the legacy behavior resolves, from an
+// environment variable in ctx. Only the native syntax is checked, JSON
+// references are in templates.
+func warnEnvReferences(body hcl.Body, ctx *hcl.EvalContext) hcl.Diagnostics {
+	syntaxBody, ok := body.(*hclsyntax.Body)
+	if !ok {
+		return nil
+	}
+
+	var diags hcl.Diagnostics
+	hclsyntax.VisitAll(syntaxBody, func(node hclsyntax.Node) hcl.Diagnostics {
+		expr, ok := node.(*hclsyntax.ScopeTraversalExpr)
+		if !ok {
+			return nil
+		}
+
+		name := expr.Traversal.RootName()
+		if _, ok := ctx.Variables[name]; !ok || name == "env" {
+			return nil
+		}
+
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  "Reference to undeclared variable",
+			Detail: fmt.Sprintf("There is no variable named %q, the environment variable is "+
+				"only available as a top-level variable with the legacy behavior. "+
+				"Reference it as env.%s instead.", name, name),
+			Subject: expr.SrcRange.Ptr(),
+		})
+		return nil
+	})
+
+	return diags
+}
+
+var unknownVariableRe = regexp.MustCompile(`^There is no variable named "([^"]+)"`)
+
+// hintEnvVariables adds a hint to "Unknown variable" errors that refer to
+// an environment variable the way earlier versions of gon allowed.
+func hintEnvVariables(diags hcl.Diagnostics, opts *LoadOptions) hcl.Diagnostics {
+	if opts.LegacyEnvVariables {
+		return diags
+	}
+
+	for _, d := range diags {
+		if d.Summary != "Unknown variable" {
+			continue
+		}
+
+		m := unknownVariableRe.FindStringSubmatch(d.Detail)
+		if m == nil {
+			continue
+		}
+		if _, ok := os.LookupEnv(m[1]); ok {
+			d.Detail += fmt.Sprintf(
+				" Environment variables must be referenced as env.%s, or enable the "+
+					"legacy behavior where they are top-level variables.", m[1])
+		}
+	}
+
+	return diags
+}
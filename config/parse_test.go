@@ -0,0 +1,267 @@
+package config
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/sebdah/goldie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	goldie.FixtureDir = "testdata"
+	spew.Config.DisablePointerAddresses = true
+	spew.Config.SortKeys = true
+}
+
+func TestParseFile(t *testing.T) {
+	f, err := os.Open("testdata")
+	require.NoError(t, err)
+	defer f.Close()
+
+	fis, err := f.Readdir(-1)
+	require.NoError(t, err)
+	for _, fi := range fis {
+		if fi.IsDir() {
+			continue
+		}
+
+		if filepath.Ext(fi.Name()) == ".golden" {
+			continue
+		}
+
+		t.Run(fi.Name(), func(t *testing.T) {
+			cfg, err := ParseFile(filepath.Join("testdata", fi.Name()))
+			require.NoError(t, err)
+			goldie.Assert(t, fi.Name(), []byte(spew.Sdump(cfg)))
+		})
+	}
+}
+
+func TestEnvVarsConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "config_*.hcl")
+	require.NoError(t, err, "Failed to create temp file")
+	defer os.Remove(f.Name())
+
+	_, err = io.WriteString(f, `
+apple_id {
+  username = "${env.AC_USER}" 		# New style.
+  password = "$env:AC_PASSWORD" 	# Old style
+}`)
+	require.NoError(t, err, "Failed to write test config")
+
+	// Set env variables.
+	require.NoError(t, os.Setenv("AC_USER", "user"), "Failed to set AC_USER")
+
+	// Parse and check env vars were substituted to the config.
+	cfg, err := ParseFile(f.Name())
+	require.NoError(t, err, "Failed to parse config")
+
+	assert.Equal(t, "user", cfg.AppleId.Username)
+	assert.Equal(t, "$env:AC_PASSWORD", cfg.AppleId.Password)
+}
+
+func TestEnvVarsConfig_legacy(t *testing.T) {
+	require.NoError(t, os.Setenv("AC_USER", "user"), "Failed to set AC_USER")
+
+	const src = `
+apple_id {
+  username = "${AC_USER}"
+}`
+
+	// Top-level environment variables are an error by default, with a
+	// hint about env.
+	_, diags := Load(strings.NewReader(src), "config.hcl", nil)
+	require.True(t, diags.HasErrors())
+	assert.Contains(t, diags.Error(), "env.AC_USER")
+
+	// With the legacy behavior they're warnings instead
+	cfg, diags := Load(strings.NewReader(src), "config.hcl", &LoadOptions{
+		LegacyEnvVariables: true,
+	})
+	require.False(t, diags.HasErrors(), diags.Error())
+	assert.Equal(t, "user", cfg.AppleId.Username)
+	require.Len(t, diags, 1)
+	assert.Equal(t, hcl.DiagWarning, diags[0].Severity)
+	assert.Contains(t, diags[0].Detail, "env.AC_USER")
+	assert.Equal(t, 3, diags[0].Subject.Start.Line)
+}
+
+func TestParse_format(t *testing.T) {
+	const hclSrc = `
+source = ["./terraform"]
+bundle_id = "com.example"
+`
+	const jsonSrc = `{"source": ["./terraform"], "bundle_id": "com.example"}`
+
+	cases := []struct {
+		Name     string
+		Src      string
+		Filename string
+		Format   string
+		Err      bool
+	}{
+		{"stdin hcl", hclSrc, "<stdin>", "", false},
+		{"stdin json", jsonSrc, "<stdin>", "", false},
+		{"explicit hcl", hclSrc, "<stdin>", FormatHCL, false},
+		{"explicit json", jsonSrc, "<stdin>", FormatJSON, false},
+		{"extension overrides sniffing", jsonSrc, "config.hcl", "", true},
+		{"unknown extension sniffs", jsonSrc, "config.conf", "", false},
+		{"wrong explicit format", hclSrc, "<stdin>", FormatJSON, true},
+		{"unsupported format", hclSrc, "<stdin>", "yaml", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			cfg, err := Parse(strings.NewReader(tc.Src), tc.Filename, tc.Format)
+			if tc.Err {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, []string{"./terraform"}, cfg.Source)
+			assert.Equal(t, "com.example", cfg.BundleId)
+		})
+	}
+}
+
+func TestParse_diagnosticsSource(t *testing.T) {
+	_, err := Parse(strings.NewReader("source = \n"), "<stdin>", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "<stdin>:")
+}
+
+func TestParse_locals(t *testing.T) {
+	cfg, err := Parse(strings.NewReader(`
+locals {
+  id = "${local.prefix}.app"
+}
+
+locals {
+  prefix = "com.example"
+}
+
+bundle_id = local.id
+`), "config.hcl", "")
+	require.NoError(t, err)
+	assert.Equal(t, "com.example.app", cfg.BundleId)
+}
+
+func TestParse_localsErrors(t *testing.T) {
+	cases := map[string]string{
+		"cycle": `
+locals {
+  a = local.b
+  b = local.a
+}`,
+		"self reference": `
+locals {
+  a = "${local.a}x"
+}`,
+		"duplicate": `
+locals {
+  a = "x"
+}
+
+locals {
+  a = "y"
+}`,
+		"undefined": `
+bundle_id = local.nope
+`,
+	}
+
+	for name, src := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(src), "config.hcl", "")
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestLoad_variables(t *testing.T) {
+	require := require.New(t)
+
+	varFile := filepath.Join("testdata", "files", "vars.hcl")
+
+	const src = `
+variable "bundle_id" {
+  default = "com.example.default"
+}
+
+variable "identity" {
+  description = "The signing identity"
+}
+
+variable "output" {
+  default = "app.zip"
+}
+
+bundle_id = var.bundle_id
+source    = ["./app"]
+
+sign {
+  application_identity = var.identity
+}
+
+zip {
+  output_path = var.output
+}
+`
+
+	cfg, diags := Load(strings.NewReader(src), "config.hcl", &LoadOptions{
+		VariableFiles: []string{varFile},
+		Variables: map[string]string{
+			"output": "flag.zip",
+			"nope":   "x",
+		},
+	})
+	require.False(diags.HasErrors(), diags.Error())
+	require.Equal("com.example.default", cfg.BundleId)
+	require.Equal("Developer ID Application: Example", cfg.Sign.ApplicationIdentity)
+	require.Equal("flag.zip", cfg.Zip.OutputPath)
+
+	// Values for undeclared variables are warnings. The file one points to
+	// where it was set.
+	require.Len(diags, 2)
+	require.Equal(hcl.DiagWarning, diags[0].Severity)
+	require.Contains(diags[0].Detail, `"nope"`)
+	require.Contains(diags[1].Detail, `"unused"`)
+	require.Equal(varFile, diags[1].Subject.Filename)
+}
+
+func TestLoad_variablesErrors(t *testing.T) {
+	cases := map[string]string{
+		"required": `
+variable "id" {}
+bundle_id = var.id
+`,
+		"duplicate": `
+variable "id" { default = "a" }
+variable "id" { default = "b" }
+`,
+		"undeclared": `
+bundle_id = var.id
+`,
+		"unknown attribute": `
+variable "id" {
+  type = string
+}
+`,
+	}
+
+	for name, src := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, diags := Load(strings.NewReader(src), "config.hcl", nil)
+			require.True(t, diags.HasErrors())
+		})
+	}
+}
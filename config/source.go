@@ -0,0 +1,131 @@
+package config
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+)
+
+// source records where a block and its settings were defined so that
+// diagnostics can point at them. A nil source is valid and gives nil
+// ranges, as for configurations that weren't loaded from a file.
+type source struct {
+	// DefRange is the range of the block header. For the top level this
+	// is the same as Missing.
+	DefRange hcl.Range
+
+	// Missing is the range to report settings missing from the block at.
+	Missing hcl.Range
+
+	// Attrs are the ranges of the attributes set in the block.
+	Attrs map[string]hcl.Range
+
+	// Blocks are the header ranges of the first nested block of each type.
+	Blocks map[string]hcl.Range
+}
+
+// def returns the range of the block itself.
+func (s *source) def() *hcl.Range {
+	if s == nil {
+		return nil
+	}
+
+	return s.DefRange.Ptr()
+}
+
+// attr returns the range of the named attribute, or where it's missing
+// if it isn't set.
+func (s *source) attr(name string) *hcl.Range {
+	if s == nil {
+		return nil
+	}
+	if r, ok := s.Attrs[name]; ok {
+		return r.Ptr()
+	}
+
+	return s.Missing.Ptr()
+}
+
+// block returns the range of the first nested block of the given type,
+// or where it's missing if there is none.
+func (s *source) block(typ string) *hcl.Range {
+	if s == nil {
+		return nil
+	}
+	if r, ok := s.Blocks[typ]; ok {
+		return r.Ptr()
+	}
+
+	return s.Missing.Ptr()
+}
+
+// recordSources records the sources of the configuration decoded from
+// body. Diagnostics are ignored since decoding already reported them.
+func recordSources(body hcl.Body, cfg *Config) {
+	content, src := sourceContent(body, cfg)
+	src.DefRange = src.Missing
+	cfg.src = src
+
+	var targets int
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case "apple_id":
+			if cfg.AppleId != nil {
+				_, cfg.AppleId.src = sourceContent(block.Body, cfg.AppleId)
+				cfg.AppleId.src.DefRange = block.DefRange
+			}
+
+		case "timeouts":
+			if cfg.Timeouts != nil {
+				_, cfg.Timeouts.src = sourceContent(block.Body, cfg.Timeouts)
+				cfg.Timeouts.src.DefRange = block.DefRange
+			}
+
+		case "keychain":
+			if cfg.Keychain != nil {
+				_, cfg.Keychain.src = sourceContent(block.Body, cfg.Keychain)
+				cfg.Keychain.src.DefRange = block.DefRange
+			}
+
+		case "target":
+			if targets >= len(cfg.Target) {
+				continue
+			}
+			t := &cfg.Target[targets]
+			targets++
+
+			targetContent, targetSrc := sourceContent(block.Body, t)
+			targetSrc.DefRange = block.DefRange
+			t.src = targetSrc
+
+			for _, nested := range targetContent.Blocks {
+				if nested.Type == "apple_id" && t.AppleId != nil {
+					_, t.AppleId.src = sourceContent(nested.Body, t.AppleId)
+					t.AppleId.src.DefRange = nested.DefRange
+				}
+			}
+		}
+	}
+}
+
+// sourceContent returns the content of body for the schema of val and the
+// ranges of its attributes and blocks.
+func sourceContent(body hcl.Body, val interface{}) (*hcl.BodyContent, *source) {
+	schema, _ := gohcl.ImpliedBodySchema(val)
+	content, _, _ := body.PartialContent(schema)
+
+	src := &source{
+		Missing: content.MissingItemRange,
+		Attrs:   map[string]hcl.Range{},
+		Blocks:  map[string]hcl.Range{},
+	}
+	for name, attr := range content.Attributes {
+		src.Attrs[name] = attr.Range
+	}
+	for _, block := range content.Blocks {
+		if _, ok := src.Blocks[block.Type]; !ok {
+			src.Blocks[block.Type] = block.DefRange
+		}
+	}
+
+	return content, src
+}
@@ -0,0 +1,22 @@
+locals {
+  name     = "terraform"
+  version  = trimspace(file("testdata/files/VERSION"))
+  archive  = format("./dist/%s_%s", local.name, local.version)
+  packages = ["pkg", "dmg"]
+}
+
+source    = [for p in ["darwin_amd64", "darwin_arm64"] : "./dist/${local.name}_${p}"]
+bundle_id = join(".", ["com", "example", lower("Terraform")])
+
+dynamic "notarize" {
+  for_each = local.packages
+  content {
+    path      = "${local.archive}.${notarize.value}"
+    bundle_id = "com.example.terraform"
+    staple    = true
+  }
+}
+
+sign {
+  application_identity = upper("foo")
+}
@@ -0,0 +1,3 @@
+identity = "Developer ID Application: Example"
+output   = "file.zip"
+unused   = true
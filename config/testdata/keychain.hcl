@@ -0,0 +1,11 @@
+source = ["./terraform"]
+bundle_id = "com.mitchellh.test.terraform"
+
+sign {
+  application_identity = "Developer ID Application: Example"
+}
+
+keychain {
+  p12_content = "@env:SIGNING_P12"
+  password    = "@env:SIGNING_P12_PASSWORD"
+}
@@ -0,0 +1,23 @@
+source = ["./terraform"]
+bundle_id = "com.mitchellh.test.terraform"
+
+sign {
+  application_identity    = "foo"
+  identifier              = "com.mitchellh.terraform"
+  prefix                  = "com.mitchellh."
+  keychain                = "/tmp/signing.keychain-db"
+  timestamp               = "none"
+  options                 = ["library"]
+  preserve_metadata       = ["entitlements", "requirements"]
+  strip_disallowed_xattrs = true
+  extra_args              = ["--force"]
+  deep                    = true
+
+  rule {
+    paths                = ["./terraform"]
+    application_identity = "bar"
+    entitlements_file    = "terraform.entitlements"
+    identifier           = "com.mitchellh.terraform.cli"
+    options              = ["kill"]
+  }
+}
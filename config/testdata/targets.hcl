@@ -0,0 +1,38 @@
+bundle_id = "com.example.app"
+
+apple_id {
+  username = "mitchellh@example.com"
+  password = "hello"
+}
+
+target "app" {
+  source = ["./app"]
+
+  sign {
+    application_identity = "foo"
+    entitlements_file = "/path/to/app.entitlements"
+  }
+
+  dmg {
+    output_path = "app.dmg"
+    volume_name = "App"
+  }
+}
+
+target "helper" {
+  source = ["./helper"]
+  bundle_id = "com.example.helper"
+
+  sign {
+    application_identity = "bar"
+  }
+
+  zip {
+    output_path = "helper.zip"
+  }
+
+  apple_id {
+    api_key = "ABCDEF1234"
+    api_issuer = "57246542-96fe-1a63-e053-0824d011072a"
+  }
+}
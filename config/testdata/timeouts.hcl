@@ -0,0 +1,12 @@
+source = ["./terraform"]
+bundle_id = "com.mitchellh.test.terraform"
+
+sign {
+  application_identity = "foo"
+}
+
+timeouts {
+  total    = "2h"
+  notarize = "1h30m"
+  command  = "10m"
+}
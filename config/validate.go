@@ -0,0 +1,446 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/bi-zone/gon/apikey"
+)
+
+// DefaultPassword is the password used for an Apple ID if none is set.
+const DefaultPassword = "@env:AC_PASSWORD"
+
+// ValidateOptions are the options for Validate.
+type ValidateOptions struct {
+	// Targets are the names of the targets to validate. All targets are
+	// validated if empty.
+	Targets []string
+
+	// DontNotarize skips validating the apple_id settings since they are
+	// only required for notarization.
+	DontNotarize bool
+}
+
+// Validate checks that the configuration can be processed. The returned
+// diagnostics point at the relevant parts of the configuration file if it
+// was loaded with Load or Parse.
+//
+// The apple_id settings are validated with the environment variable
+// defaults applied, see AppleId.ApplyEnv. opts may be nil.
+func Validate(cfg *Config, opts *ValidateOptions) hcl.Diagnostics {
+	if opts == nil {
+		opts = &ValidateOptions{}
+	}
+
+	var diags hcl.Diagnostics
+
+	defined := map[string]*Target{}
+	for i := range cfg.Target {
+		t := &cfg.Target[i]
+		if prev, ok := defined[t.Name]; ok {
+			detail := fmt.Sprintf("A target named %q was already defined.", t.Name)
+			if r := prev.src.def(); r != nil {
+				detail = fmt.Sprintf("A target named %q was already defined at %s.", t.Name, r)
+			}
+
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate target",
+				Detail:   detail,
+				Subject:  t.src.def(),
+			})
+			continue
+		}
+		defined[t.Name] = t
+	}
+
+	for _, name := range opts.Targets {
+		if _, ok := defined[name]; !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unknown target",
+				Detail:   fmt.Sprintf("There is no target named %q in the configuration.", name),
+			})
+		}
+	}
+	diags = append(diags, cfg.Timeouts.Validate()...)
+	diags = append(diags, cfg.Keychain.Validate()...)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	targets, err := cfg.SelectTargets(opts.Targets)
+	if err != nil {
+		// Not reachable after the checks above, but don't hide it.
+		return append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid targets",
+			Detail:   err.Error(),
+		})
+	}
+
+	for _, t := range targets {
+		diags = append(diags, t.Validate()...)
+	}
+
+	if !opts.DontNotarize {
+		// Targets without their own apple_id share the top-level one, so
+		// each block is only validated once.
+		seen := map[*AppleId]bool{}
+		for _, t := range targets {
+			if seen[t.AppleId] {
+				continue
+			}
+			seen[t.AppleId] = true
+
+			diags = append(diags, t.AppleId.Validate()...)
+		}
+	}
+
+	return diags
+}
+
+// Validate checks the sign and package settings of the target.
+func (t *Target) Validate() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	where := ""
+	if t.Name != "" {
+		where = fmt.Sprintf(" in target %q", t.Name)
+	}
+
+	if len(t.Source) > 0 {
+		if t.BundleId == "" {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "`bundle_id` configuration required with `source` set" + where,
+				Detail: "When you set the `source` configuration, you must also specify the " +
+					"`bundle_id` that will be used for packaging and notarization.",
+				Subject: t.src.attr("source"),
+			})
+		}
+
+		if t.Sign == nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "`sign` configuration required with `source` set" + where,
+				Detail: "When you set the `source` configuration, you must also specify the " +
+					"`sign` configuration to sign the input files.",
+				Subject: t.src.attr("source"),
+			})
+		} else {
+			for _, setting := range []struct{ name, value string }{
+				{"expiry_warning", t.Sign.ExpiryWarning},
+				{"expiry_error", t.Sign.ExpiryError},
+			} {
+				if _, err := parseExpiry(setting.value); err != nil {
+					diags = append(diags, &hcl.Diagnostic{
+						Severity: hcl.DiagError,
+						Summary:  fmt.Sprintf("Invalid sign `%s`%s", setting.name, where),
+						Detail: fmt.Sprintf("The value must be a duration such as \"720h\": %s.",
+							strings.TrimPrefix(err.Error(), "time: ")),
+						Subject: t.src.block("sign"),
+					})
+				}
+			}
+
+			diags = append(diags, t.validateRules(where)...)
+
+			if ts := t.Sign.Timestamp; ts != "" && ts != "none" &&
+				!strings.HasPrefix(ts, "http://") && !strings.HasPrefix(ts, "https://") {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid sign `timestamp`" + where,
+					Detail: fmt.Sprintf("The timestamp must be the URL of a time-stamping server "+
+						"or \"none\", not %q.", ts),
+					Subject: t.src.block("sign"),
+				})
+			}
+		}
+
+		return diags
+	}
+
+	if len(t.Notarize) == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "No source files specified" + where,
+			Detail: "Your configuration had an empty `source` and empty `notarize` values. " +
+				"This must be populated with at least one file to sign, package, and notarize.",
+			Subject: t.src.def(),
+		})
+	}
+
+	if t.Zip != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "`zip` can only be set while `source` is also set" + where,
+			Detail: "Zip packaging is only supported when `source` is specified. This is " +
+				"because the `zip` option packages the source files. If there are no " +
+				"source files specified, then there is nothing to package.",
+			Subject: t.src.block("zip"),
+		})
+	}
+
+	if t.Dmg != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "`dmg` can only be set while `source` is also set" + where,
+			Detail: "Dmg packaging is only supported when `source` is specified. This is " +
+				"because the `dmg` option packages the source files. If there are no " +
+				"source files specified, then there is nothing to package.",
+			Subject: t.src.block("dmg"),
+		})
+	}
+
+	return diags
+}
+
+// validateRules checks that each sign rule has valid paths that match at
+// least one source file, or a path inside one when signing deep. A rule
+// that matches nothing is most likely a typo.
+func (t *Target) validateRules(where string) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for i, rule := range t.Sign.Rule {
+		if len(rule.Paths) == 0 {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("No `paths` in sign rule %d%s", i+1, where),
+				Detail:   "A sign rule must list the paths or glob patterns of the source files it applies to.",
+				Subject:  t.src.block("sign"),
+			})
+			continue
+		}
+
+		matched := false
+		for _, path := range rule.Paths {
+			if _, err := filepath.Match(path, ""); err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  fmt.Sprintf("Invalid path in sign rule %d%s", i+1, where),
+					Detail:   fmt.Sprintf("The glob pattern %q is malformed.", path),
+					Subject:  t.src.block("sign"),
+				})
+				matched = true
+				break
+			}
+
+			for _, file := range t.Source {
+				if ok, _ := filepath.Match(filepath.Clean(path), filepath.Clean(file)); ok {
+					matched = true
+				}
+
+				// Nested code isn't known before signing
+				if t.Sign.Deep && strings.HasPrefix(filepath.Clean(path), filepath.Clean(file)+string(filepath.Separator)) {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Sign rule %d matches no source file%s", i+1, where),
+				Detail: fmt.Sprintf("None of the paths %q match a file in `source`. The paths are "+
+					"matched against the entries of `source` as written, and with `deep` "+
+					"against the code nested in them.", rule.Paths),
+				Subject: t.src.block("sign"),
+			})
+		}
+	}
+
+	return diags
+}
+
+// Validate checks that the timeouts are positive durations. The receiver
+// may be nil.
+func (t *Timeouts) Validate() hcl.Diagnostics {
+	if t == nil {
+		return nil
+	}
+
+	var diags hcl.Diagnostics
+	for _, setting := range []struct{ name, value string }{
+		{"total", t.Total},
+		{"notarize", t.Notarize},
+		{"command", t.Command},
+	} {
+		if _, err := parseTimeout(setting.value); err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Invalid `%s` timeout", setting.name),
+				Detail: fmt.Sprintf("The timeout must be a duration such as \"30m\" or \"1h30m\": %s.",
+					strings.TrimPrefix(err.Error(), "time: ")),
+				Subject: t.src.attr(setting.name),
+			})
+		}
+	}
+
+	return diags
+}
+
+// Validate checks that exactly one of the .p12 path and content is set.
+// The receiver may be nil.
+func (k *Keychain) Validate() hcl.Diagnostics {
+	if k == nil {
+		return nil
+	}
+
+	switch {
+	case k.P12Path == "" && k.P12Content == "":
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "No keychain `p12_path` or `p12_content` provided",
+			Detail: "The .p12 file with the signing identity to import into the temporary keychain " +
+				"must be specified in the `keychain` block.",
+			Subject: k.src.def(),
+		}}
+	case k.P12Path != "" && k.P12Content != "":
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Both keychain `p12_path` and `p12_content` provided",
+			Detail:   "Only one of the path to the .p12 file and its content can be specified.",
+			Subject:  k.src.attr("p12_content"),
+		}}
+	}
+
+	return nil
+}
+
+// ApplyEnv sets the settings that aren't set from the environment:
+// AC_USERNAME, AC_APIKEY, AC_APIKEY_CONTENT, AC_APIISSUER, AC_PROVIDER
+// and AC_KEYCHAIN_PROFILE. The password defaults to DefaultPassword.
+func (a *AppleId) ApplyEnv() {
+	if a.Username == "" {
+		a.Username = os.Getenv("AC_USERNAME")
+	}
+	if a.Password == "" {
+		a.Password = DefaultPassword
+	}
+	if a.ApiKey == "" {
+		a.ApiKey = os.Getenv("AC_APIKEY")
+	}
+	if a.ApiKeyContent == "" {
+		a.ApiKeyContent = os.Getenv("AC_APIKEY_CONTENT")
+	}
+	if a.ApiIssuer == "" {
+		a.ApiIssuer = os.Getenv("AC_APIISSUER")
+	}
+	if a.Provider == "" {
+		a.Provider = os.Getenv("AC_PROVIDER")
+	}
+	if a.KeychainProfile == "" {
+		a.KeychainProfile = os.Getenv("AC_KEYCHAIN_PROFILE")
+	}
+}
+
+// Validate checks that the credentials are complete with the environment
+// defaults applied, see ApplyEnv. The receiver isn't modified and may be
+// nil if there is no apple_id block. If an API key is set it is loaded
+// so a bad key is reported before anything is signed or packaged.
+func (a *AppleId) Validate() hcl.Diagnostics {
+	return a.validate(false)
+}
+
+// ValidateStore checks that the credentials can be stored in a notarytool
+// keychain profile, see `gon store-credentials`: the profile must be named
+// and the Apple ID and password or the API key must be complete.
+func (a *AppleId) ValidateStore() hcl.Diagnostics {
+	return a.validate(true)
+}
+
+// validate implements Validate and ValidateStore.
+func (a *AppleId) validate(store bool) hcl.Diagnostics {
+	var creds AppleId
+	if a != nil {
+		creds = *a
+	}
+	creds.ApplyEnv()
+	src := creds.src
+
+	// The profile holds all that's needed to notarize, but it must be named
+	// to store the credentials in it.
+	switch {
+	case !store && creds.KeychainProfile != "":
+		return nil
+	case store && creds.KeychainProfile == "":
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "No apple_id `keychain_profile` provided",
+			Detail: "The name of the keychain profile to store the credentials in must be specified " +
+				"in the `apple_id` block or in the environment as AC_KEYCHAIN_PROFILE.",
+			Subject: src.def(),
+		}}
+	}
+
+	// Neither of the authentication methods were chosen.
+	if creds.Username == "" && creds.ApiKey == "" {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "No apple_id `username` or `api_key` provided",
+			Detail: "An Apple ID username OR API key must be specified in the `apple_id` block or " +
+				"in the appropriate environment variables (AC_USERNAME and AC_APIKEY relatively), " +
+				"otherwise we won't be able to authenticate with Apple to notarize.",
+			Subject: src.def(),
+		}}
+	}
+
+	// Looks like a password authentication: verify that password is set.
+	// The API key takes precedence when notarizing, so then it's the API
+	// key that must be valid.
+	if creds.Username != "" && creds.ApiKey == "" {
+		envName := strings.TrimPrefix(DefaultPassword, "@env:")
+		if creds.Password == DefaultPassword {
+			if _, ok := os.LookupEnv(envName); !ok {
+				return hcl.Diagnostics{{
+					Severity: hcl.DiagError,
+					Summary:  "No apple_id `password` provided",
+					Detail: fmt.Sprintf("An Apple ID password (or lookup directive) must be specified in the "+
+						"`apple_id` block or it must exist in the environment as %s, "+
+						"otherwise we won't be able to authenticate with Apple to notarize.", envName),
+					Subject: src.attr("password"),
+				}}
+			}
+		}
+
+		return nil
+	}
+
+	// API authentication.
+	if creds.ApiIssuer == "" {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "No apple_id `api_issuer` provided",
+			Detail: "An issuer of the App Store Connect API key must be specified in the " +
+				"`apple_id` block or it must exist in the environment as AC_APIISSUER, " +
+				"otherwise we won't be able to authenticate with AC API to notarize.",
+			Subject: src.attr("api_issuer"),
+		}}
+	}
+
+	var err error
+	subject := src.attr("api_key")
+	switch {
+	case creds.ApiKeyPath != "":
+		_, err = apikey.Load(creds.ApiKeyPath, creds.ApiKey, creds.ApiIssuer)
+		subject = src.attr("api_key_path")
+	case creds.ApiKeyContent != "":
+		_, err = apikey.ParseContent(creds.ApiKeyContent, creds.ApiKey, creds.ApiIssuer)
+		subject = src.attr("api_key_content")
+	default:
+		_, err = apikey.Load("", creds.ApiKey, creds.ApiIssuer)
+	}
+	if err != nil {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid apple_id `api_key`",
+			Detail:   fmt.Sprintf("The App Store Connect API key couldn't be loaded: %s.", err),
+			Subject:  subject,
+		}}
+	}
+
+	return nil
+}
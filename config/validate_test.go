@@ -0,0 +1,362 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	os.Setenv("AC_PASSWORD", "secret")
+	defer os.Unsetenv("AC_PASSWORD")
+
+	cases := []struct {
+		Name    string
+		Src     string
+		Opts    *ValidateOptions
+		Summary string
+		Line    int
+	}{
+		{
+			"valid",
+			`
+source    = ["./app"]
+bundle_id = "com.example.app"
+sign { application_identity = "foo" }
+apple_id { username = "foo@example.com" }
+`,
+			nil, "", 0,
+		},
+		{
+			"source without bundle_id",
+			`
+source = ["./app"]
+sign { application_identity = "foo" }
+apple_id { username = "foo@example.com" }
+`,
+			nil, "`bundle_id` configuration required with `source` set", 2,
+		},
+		{
+			"no files",
+			`
+apple_id { username = "foo@example.com" }
+`,
+			nil, "No source files specified", 1,
+		},
+		{
+			"zip without source",
+			`
+notarize {
+  path      = "app.pkg"
+  bundle_id = "com.example.app"
+}
+
+zip { output_path = "app.zip" }
+apple_id { username = "foo@example.com" }
+`,
+			nil, "`zip` can only be set while `source` is also set", 7,
+		},
+		{
+			"target",
+			`
+apple_id { username = "foo@example.com" }
+
+target "app" {
+  source = ["./app"]
+  sign { application_identity = "foo" }
+}
+`,
+			nil, "`bundle_id` configuration required with `source` set in target \"app\"", 5,
+		},
+		{
+			"duplicate target",
+			`
+target "app" {}
+target "app" {}
+`,
+			nil, "Duplicate target", 3,
+		},
+		{
+			"unknown target",
+			`
+target "app" {}
+`,
+			&ValidateOptions{Targets: []string{"nope"}}, "Unknown target", 0,
+		},
+		{
+			"api key without issuer",
+			`
+source    = ["./app"]
+bundle_id = "com.example.app"
+sign { application_identity = "foo" }
+
+apple_id {
+  api_key = "ABCDEF1234"
+}
+`,
+			nil, "No apple_id `api_issuer` provided", 6,
+		},
+		{
+			"invalid api key content",
+			`
+source    = ["./app"]
+bundle_id = "com.example.app"
+sign { application_identity = "foo" }
+
+apple_id {
+  api_key         = "ABCDEF1234"
+  api_issuer      = "57246542-96fe-1a63-e053-0824d011072a"
+  api_key_content = "not a key!"
+}
+`,
+			nil, "Invalid apple_id `api_key`", 9,
+		},
+		{
+			"api key and username without issuer",
+			`
+source    = ["./app"]
+bundle_id = "com.example.app"
+sign { application_identity = "foo" }
+
+apple_id {
+  username = "foo@example.com"
+  password = "hunter2"
+  api_key  = "ABCDEF1234"
+}
+`,
+			nil, "No apple_id `api_issuer` provided", 6,
+		},
+		{
+			"invalid api key content with username",
+			`
+source    = ["./app"]
+bundle_id = "com.example.app"
+sign { application_identity = "foo" }
+
+apple_id {
+  username        = "foo@example.com"
+  password        = "hunter2"
+  api_key         = "ABCDEF1234"
+  api_issuer      = "57246542-96fe-1a63-e053-0824d011072a"
+  api_key_content = "not a key!"
+}
+`,
+			nil, "Invalid apple_id `api_key`", 11,
+		},
+		{
+			"invalid timeout",
+			`
+source    = ["./app"]
+bundle_id = "com.example.app"
+sign { application_identity = "foo" }
+apple_id { username = "foo@example.com" }
+
+timeouts {
+  total   = "2h"
+  command = "10"
+}
+`,
+			nil, "Invalid `command` timeout", 9,
+		},
+		{
+			"invalid expiry",
+			`
+source    = ["./app"]
+bundle_id = "com.example.app"
+apple_id { username = "foo@example.com" }
+
+sign {
+  application_identity = "foo"
+  expiry_warning       = "30d"
+}
+`,
+			nil, "Invalid sign `expiry_warning`", 6,
+		},
+		{
+			"invalid timestamp",
+			`
+source    = ["./app"]
+bundle_id = "com.example.app"
+apple_id { username = "foo@example.com" }
+
+sign {
+  application_identity = "foo"
+  timestamp            = "timestamp.example.com"
+}
+`,
+			nil, "Invalid sign `timestamp`", 6,
+		},
+		{
+			"sign rule without match",
+			`
+source    = ["./app", "./helper"]
+bundle_id = "com.example.app"
+apple_id { username = "foo@example.com" }
+
+sign {
+  application_identity = "foo"
+
+  rule {
+    paths = ["./helpers/*"]
+  }
+}
+`,
+			nil, "Sign rule 1 matches no source file", 6,
+		},
+		{
+			"sign rule",
+			`
+source    = ["./app", "./helper"]
+bundle_id = "com.example.app"
+apple_id { username = "foo@example.com" }
+
+sign {
+  application_identity = "foo"
+
+  rule {
+    paths = ["helper*"]
+  }
+}
+`,
+			nil, "", 0,
+		},
+		{
+			"sign rule for nested code",
+			`
+source    = ["./App.app"]
+bundle_id = "com.example.app"
+apple_id { username = "foo@example.com" }
+
+sign {
+  application_identity = "foo"
+  deep                 = true
+
+  rule {
+    paths = ["./App.app/Contents/XPCServices/*.xpc"]
+  }
+}
+`,
+			nil, "", 0,
+		},
+		{
+			"keychain without p12",
+			`
+source    = ["./app"]
+bundle_id = "com.example.app"
+sign { application_identity = "foo" }
+apple_id { username = "foo@example.com" }
+
+keychain {
+  password = "@env:P12_PASSWORD"
+}
+`,
+			nil, "No keychain `p12_path` or `p12_content` provided", 7,
+		},
+		{
+			"keychain with both p12 settings",
+			`
+source    = ["./app"]
+bundle_id = "com.example.app"
+sign { application_identity = "foo" }
+apple_id { username = "foo@example.com" }
+
+keychain {
+  p12_path    = "identity.p12"
+  p12_content = "@env:P12_CONTENT"
+}
+`,
+			nil, "Both keychain `p12_path` and `p12_content` provided", 9,
+		},
+		{
+			"keychain profile",
+			`
+source    = ["./app"]
+bundle_id = "com.example.app"
+sign { application_identity = "foo" }
+apple_id { keychain_profile = "gon" }
+`,
+			nil, "", 0,
+		},
+		{
+			"dont notarize",
+			`
+source    = ["./app"]
+bundle_id = "com.example.app"
+sign { application_identity = "foo" }
+`,
+			&ValidateOptions{DontNotarize: true}, "", 0,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			cfg, err := Parse(strings.NewReader(tc.Src), "config.hcl", "")
+			require.NoError(t, err)
+
+			diags := Validate(cfg, tc.Opts)
+			if tc.Summary == "" {
+				require.Empty(t, diags, diags.Error())
+				return
+			}
+
+			require.True(t, diags.HasErrors())
+			assert.Equal(t, tc.Summary, diags[0].Summary)
+			if tc.Line == 0 {
+				assert.Nil(t, diags[0].Subject)
+				return
+			}
+
+			require.NotNil(t, diags[0].Subject)
+			assert.Equal(t, "config.hcl", diags[0].Subject.Filename)
+			assert.Equal(t, tc.Line, diags[0].Subject.Start.Line)
+		})
+	}
+}
+
+func TestAppleIdValidate_env(t *testing.T) {
+	os.Unsetenv("AC_PASSWORD")
+	os.Setenv("AC_USERNAME", "foo@example.com")
+	defer os.Unsetenv("AC_USERNAME")
+
+	// Without a block the environment is used and there is nowhere to
+	// point at.
+	var appleId *AppleId
+	diags := appleId.Validate()
+	require.Len(t, diags, 1)
+	assert.Equal(t, "No apple_id `password` provided", diags[0].Summary)
+	assert.Nil(t, diags[0].Subject)
+
+	os.Setenv("AC_PASSWORD", "secret")
+	defer os.Unsetenv("AC_PASSWORD")
+	assert.Empty(t, appleId.Validate())
+
+	// The environment defaults aren't applied to the configuration.
+	appleId = &AppleId{}
+	assert.Equal(t, hcl.Diagnostics(nil), appleId.Validate())
+	assert.Empty(t, appleId.Username)
+}
+
+func TestAppleIdValidateStore(t *testing.T) {
+	os.Unsetenv("AC_KEYCHAIN_PROFILE")
+
+	// Storing needs a profile name and the credentials to store
+	appleId := &AppleId{Username: "foo@example.com", Password: "secret"}
+	diags := appleId.ValidateStore()
+	require.Len(t, diags, 1)
+	assert.Equal(t, "No apple_id `keychain_profile` provided", diags[0].Summary)
+
+	appleId.KeychainProfile = "gon"
+	assert.Empty(t, appleId.ValidateStore())
+	assert.Empty(t, appleId.Validate())
+
+	// The profile alone is enough to notarize, but not to store
+	appleId = &AppleId{KeychainProfile: "gon"}
+	assert.Empty(t, appleId.Validate())
+	diags = appleId.ValidateStore()
+	require.Len(t, diags, 1)
+	assert.Equal(t, "No apple_id `username` or `api_key` provided", diags[0].Summary)
+}
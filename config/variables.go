@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// variableSchema is the schema of the body of a `variable` block.
+var variableSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "default"},
+		{Name: "description"},
+	},
+}
+
+// variableValue is a value given for a variable from outside the
+// configuration.
+type variableValue struct {
+	Value cty.Value
+
+	// Range is where the value was set, nil for -var values.
+	Range *hcl.Range
+}
+
+// decodeVariables decodes the variable blocks, assigns the values given in
+// opts or the defaults and adds them to ctx as the "var" object.
+func decodeVariables(blocks hcl.Blocks, ctx *hcl.EvalContext, opts *LoadOptions) hcl.Diagnostics {
+	given, diags := variableValues(ctx, opts)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	values := map[string]cty.Value{}
+	declared := map[string]*hcl.Block{}
+	for _, block := range blocks {
+		name := block.Labels[0]
+		if prev, ok := declared[name]; ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate variable declaration",
+				Detail: fmt.Sprintf("A variable named %q was already declared at %s.",
+					name, prev.DefRange),
+				Subject: block.DefRange.Ptr(),
+			})
+			continue
+		}
+		declared[name] = block
+
+		content, contentDiags := block.Body.Content(variableSchema)
+		diags = append(diags, contentDiags...)
+		if contentDiags.HasErrors() {
+			continue
+		}
+
+		if v, ok := given[name]; ok {
+			values[name] = v.Value
+			continue
+		}
+
+		attr, ok := content.Attributes["default"]
+		if !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "No value for required variable",
+				Detail: fmt.Sprintf("The variable %q has no default, so a value must be "+
+					"set with -var or -var-file.", name),
+				Subject: block.DefRange.Ptr(),
+			})
+			continue
+		}
+
+		v, valDiags := attr.Expr.Value(ctx)
+		diags = append(diags, valDiags...)
+		values[name] = v
+	}
+
+	// Sort so that diagnostics come out in a stable order
+	names := make([]string, 0, len(given))
+	for name := range given {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := declared[name]; ok {
+			continue
+		}
+
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  "Value for undeclared variable",
+			Detail: fmt.Sprintf("A value was set for the variable %q but the configuration "+
+				"has no `variable %q` block, so the value is ignored.", name, name),
+			Subject: given[name].Range,
+		})
+	}
+
+	ctx.Variables["var"] = cty.ObjectVal(values)
+	return diags
+}
+
+// variableValues returns the variable values from the files and flags in
+// opts. Values set directly take precedence over values from files, and
+// later files take precedence over earlier ones.
+func variableValues(ctx *hcl.EvalContext, opts *LoadOptions) (map[string]variableValue, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	result := map[string]variableValue{}
+
+	parser := hclparse.NewParser()
+	for _, path := range opts.VariableFiles {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to read variables file",
+				Detail:   fmt.Sprintf("Failed to read %s: %s.", path, err),
+			})
+			continue
+		}
+
+		file, fileDiags := parseSource(parser, src, path, "")
+		diags = append(diags, fileDiags...)
+		if fileDiags.HasErrors() {
+			continue
+		}
+
+		attrs, attrDiags := file.Body.JustAttributes()
+		diags = append(diags, attrDiags...)
+		for name, attr := range attrs {
+			v, valDiags := attr.Expr.Value(ctx)
+			diags = append(diags, valDiags...)
+			result[name] = variableValue{Value: v, Range: attr.NameRange.Ptr()}
+		}
+	}
+
+	for name, v := range opts.Variables {
+		result[name] = variableValue{Value: cty.StringVal(v)}
+	}
+
+	return result, diags
+}
@@ -0,0 +1,92 @@
+// Package execctx runs commands that are stopped when a context is done.
+//
+// The packages of gon build their commands from a copy of an optional base
+// command so tests can replace the binary, which rules out
+// exec.CommandContext. Run ties such a command to a context instead, and
+// also stops the processes the command started.
+package execctx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// TimeoutError is returned by Run if the command was killed because it
+// ran longer than its timeout. errors.Is reports it as
+// context.DeadlineExceeded.
+type TimeoutError struct {
+	// Name is the name of the command, argv[0].
+	Name string
+
+	// Timeout is the timeout that expired.
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s didn't finish within %s", e.Name, e.Timeout)
+}
+
+// Unwrap returns context.DeadlineExceeded.
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// Run starts the command and waits for it to complete, like cmd.Run. If
+// ctx is done before the command completes, the process and the processes
+// it started, which could otherwise keep its output open, are killed and
+// ctx.Err() is returned. If timeout is positive, the process is also
+// killed once it ran that long and a *TimeoutError is returned.
+func Run(ctx context.Context, cmd *exec.Cmd, timeout time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	runCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	setGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-runCtx.Done():
+			kill(cmd)
+		case <-done:
+		}
+	}()
+
+	err := cmd.Wait()
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case runCtx.Err() != nil:
+		name := cmd.Path
+		if len(cmd.Args) > 0 {
+			name = cmd.Args[0]
+		}
+
+		return &TimeoutError{Name: filepath.Base(name), Timeout: timeout}
+	}
+
+	return err
+}
+
+// Stopped returns true if the error is from Run stopping a command, either
+// because its context was done or because it timed out.
+func Stopped(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,52 @@
+package execctx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_killsChildren(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no process groups on Windows")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The shell starts a child that would keep the output open for a
+	// minute if it outlived the shell, like notarytool run by xcrun.
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", "sleep 60; echo done")
+	cmd.Stdout = &out
+
+	start := time.Now()
+	err := Run(ctx, cmd, 0)
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.True(t, time.Since(start) < 30*time.Second)
+	require.Empty(t, out.String())
+}
+
+func TestRun_timeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh on Windows")
+	}
+
+	base := exec.Command("sh", "-c", "sleep 60")
+	cmd := *base
+	err := Run(context.Background(), &cmd, 100*time.Millisecond)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	var terr *TimeoutError
+	require.True(t, errors.As(err, &terr))
+	require.Equal(t, "sh", terr.Name)
+
+	// The base command isn't changed
+	require.Nil(t, base.SysProcAttr)
+}
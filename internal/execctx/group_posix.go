@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package execctx
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setGroup makes the command start in a process group of its own, so
+// the processes it starts, such as notarytool run by xcrun, can be
+// killed along with it.
+func setGroup(cmd *exec.Cmd) {
+	// The attributes may be shared with the base command, so copy them
+	attr := &syscall.SysProcAttr{}
+	if cmd.SysProcAttr != nil {
+		*attr = *cmd.SysProcAttr
+	}
+	attr.Setpgid = true
+	cmd.SysProcAttr = attr
+}
+
+// kill kills the process group of the command, falling back to only the
+// process itself.
+func kill(cmd *exec.Cmd) {
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,13 @@
+package execctx
+
+import (
+	"os/exec"
+)
+
+// setGroup does nothing, Windows has no process groups to kill.
+func setGroup(cmd *exec.Cmd) {}
+
+// kill kills the process of the command.
+func kill(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,106 @@
+// Package securitycmd runs the macOS security command, which manages
+// keychains and the items in them.
+//
+// It doesn't redact secrets itself, so the secret package, which resolves
+// secrets from the keychain, can use it too. The callers pass the
+// redaction functions of the secret package instead.
+package securitycmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/bi-zone/gon/internal/execctx"
+)
+
+// Options are the options for Run.
+type Options struct {
+	// Logger is the logger to use. If this is nil then no logging will be done.
+	Logger hclog.Logger
+
+	// Timeout, if positive, limits how long the security command may run.
+	Timeout time.Duration
+
+	// BaseCmd is the base command for executing the security binary. This is
+	// used for tests to overwrite where the security binary is.
+	BaseCmd *exec.Cmd
+
+	// Redact removes the secrets from the output of the command before it's
+	// logged or returned as an error. If this is nil the output is used as
+	// is.
+	Redact func(string) string
+
+	// RedactArgs removes the secrets from the command line before it's
+	// logged. If this is nil the command line is logged as is, for commands
+	// whose flags, such as -p, aren't passwords.
+	RedactArgs func([]string) []string
+}
+
+// Run runs the security binary with the given arguments and returns its
+// standard output, which is never logged. If the command fails, the error
+// is its output, or the error of execctx.Run if it was stopped or had no
+// output.
+func Run(ctx context.Context, opts *Options, args ...string) (string, error) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+	redact := opts.Redact
+	if redact == nil {
+		redact = func(s string) string { return s }
+	}
+
+	// Build our command
+	var cmd exec.Cmd
+	if opts.BaseCmd != nil {
+		cmd = *opts.BaseCmd
+	}
+
+	// We only set the path if it isn't set. This lets the options set the
+	// path to the security binary that we use.
+	if cmd.Path == "" {
+		path, err := exec.LookPath("security")
+		if err != nil {
+			return "", err
+		}
+		cmd.Path = path
+	}
+
+	cmd.Args = append([]string{filepath.Base(cmd.Path)}, args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// Log what we're going to execute
+	logArgs := cmd.Args
+	if opts.RedactArgs != nil {
+		logArgs = opts.RedactArgs(cmd.Args)
+	}
+	logger.Info("executing security",
+		"command_path", cmd.Path,
+		"command_args", logArgs,
+	)
+
+	if err := execctx.Run(ctx, &cmd, opts.Timeout); err != nil {
+		// Some commands report their errors on stdout
+		output := redact(stderr.String() + stdout.String())
+		logger.Error("error executing security", "err", err, "output", output)
+		if execctx.Stopped(err) {
+			return "", err
+		}
+		if msg := strings.TrimSpace(output); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+
+	return stdout.String(), nil
+}
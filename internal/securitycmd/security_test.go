@@ -0,0 +1,41 @@
+package securitycmd
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh on Windows")
+	}
+
+	sh, err := exec.LookPath("sh")
+	require.NoError(t, err)
+
+	opts := &Options{
+		Logger:  hclog.L(),
+		BaseCmd: &exec.Cmd{Path: sh},
+		Redact: func(s string) string {
+			return strings.Replace(s, "hunter2", "<redacted>", -1)
+		},
+	}
+
+	out, err := Run(context.Background(), opts, "-c", "echo ok")
+	require.NoError(t, err)
+	require.Equal(t, "ok\n", out)
+
+	// The error is the redacted output
+	_, err = Run(context.Background(), opts, "-c", "echo 'bad password hunter2' >&2; exit 1")
+	require.EqualError(t, err, "bad password <redacted>")
+
+	// Or the exit status if there is none
+	_, err = Run(context.Background(), opts, "-c", "exit 2")
+	require.EqualError(t, err, "exit status 2")
+}
@@ -0,0 +1,300 @@
+// Package keychain imports a signing identity into a temporary keychain,
+// for machines such as CI runners that don't have it in their keychains.
+//
+// Create runs the steps that are usually scripted around codesign: it
+// creates and unlocks a keychain, imports the .p12 file, allows codesign
+// to use the key without a prompt and adds the keychain to the search
+// list. Delete undoes all of it.
+package keychain
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/bi-zone/gon/internal/execctx"
+	"github.com/bi-zone/gon/internal/securitycmd"
+	"github.com/bi-zone/gon/secret"
+)
+
+// Options are the options for Create.
+type Options struct {
+	// P12Path is the path to the .p12 file holding the certificate and the
+	// private key of the signing identity.
+	P12Path string
+
+	// P12Content is the base64 encoded content of the .p12 file, for files
+	// that aren't on disk such as CI secrets. It's only used if P12Path
+	// isn't set and may be a reference as accepted by secret.Resolve.
+	P12Content string
+
+	// Password is the password of the .p12 file. It may be a reference as
+	// accepted by secret.Resolve. security import only takes it on the
+	// command line, so it's visible in the process list while the import
+	// runs.
+	Password string
+
+	// Logger is the logger to use. If this is nil then no logging will be done.
+	Logger hclog.Logger
+
+	// Timeout, if positive, limits how long each security command may run.
+	Timeout time.Duration
+
+	// BaseCmd is the base command for executing the security binary. This is
+	// used for tests to overwrite where the security binary is.
+	BaseCmd *exec.Cmd
+}
+
+// Keychain is a temporary keychain created by Create.
+type Keychain struct {
+	// Path is the path of the keychain. It can be passed to the codesign
+	// --keychain flag, but codesign finds the identity without it since
+	// the keychain is in the search list.
+	Path string
+
+	opts    *Options
+	logger  hclog.Logger
+	dir     string
+	created bool
+
+	// searchList is the user keychain search list before the keychain
+	// was added to it, nil if it wasn't.
+	searchList []string
+}
+
+// Create creates a keychain in a temporary directory and imports the
+// signing identity of opts into it. The keychain must be removed with
+// Delete when done. If Create fails, whatever it did is undone.
+func Create(ctx context.Context, opts *Options) (*Keychain, error) {
+	if opts.P12Path == "" && opts.P12Content == "" {
+		return nil, errors.New("no .p12 file given")
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	resolveOpts := &secret.Options{
+		Logger:  logger,
+		Timeout: opts.Timeout,
+		BaseCmd: opts.BaseCmd,
+	}
+	password, err := secret.Resolve(ctx, opts.Password, resolveOpts)
+	if err != nil {
+		return nil, err
+	}
+	if !secret.IsReference(opts.Password) {
+		secret.Register(password)
+	}
+
+	var content []byte
+	if opts.P12Path == "" {
+		encoded, err := secret.Resolve(ctx, opts.P12Content, resolveOpts)
+		if err != nil {
+			return nil, err
+		}
+		if content, err = decode(encoded); err != nil {
+			return nil, err
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "gon")
+	if err != nil {
+		return nil, err
+	}
+	k := &Keychain{
+		Path:   filepath.Join(dir, "signing.keychain-db"),
+		opts:   opts,
+		logger: logger,
+		dir:    dir,
+	}
+
+	if err := k.create(ctx, password, content); err != nil {
+		if !execctx.Stopped(err) {
+			err = fmt.Errorf("error creating keychain: %w", err)
+		}
+		k.Delete(context.Background())
+		return nil, err
+	}
+
+	logger.Info("signing identity imported into temporary keychain", "keychain", k.Path)
+	return k, nil
+}
+
+// create runs the steps of Create once the temporary directory exists.
+// content is the decoded .p12 file if it isn't read from P12Path.
+func (k *Keychain) create(ctx context.Context, password string, content []byte) error {
+	path := k.opts.P12Path
+	if path == "" {
+		path = filepath.Join(k.dir, "identity.p12")
+		if err := ioutil.WriteFile(path, content, 0600); err != nil {
+			return err
+		}
+	}
+
+	// The keychain password is random and only good for this keychain,
+	// which is deleted afterwards.
+	keychainPassword, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	secret.Register(keychainPassword)
+
+	if _, err := k.security(ctx, "create-keychain", "-p", keychainPassword, k.Path); err != nil {
+		return err
+	}
+	k.created = true
+
+	// Don't lock the keychain while signing, however long it takes
+	if _, err := k.security(ctx, "set-keychain-settings", k.Path); err != nil {
+		return err
+	}
+	if _, err := k.security(ctx, "unlock-keychain", "-p", keychainPassword, k.Path); err != nil {
+		return err
+	}
+
+	// security import has no way to read the password from stdin or a
+	// file, -P is the only option that doesn't prompt. The password is on
+	// its command line for as long as the import runs, a fraction of a
+	// second, and is redacted from the logs.
+	_, err = k.security(ctx,
+		"import", path,
+		"-k", k.Path,
+		"-f", "pkcs12",
+		"-P", password,
+		"-T", "/usr/bin/codesign",
+		"-T", "/usr/bin/security",
+	)
+	if err != nil {
+		return fmt.Errorf("error importing %s: %w", filepath.Base(path), err)
+	}
+
+	// Let codesign use the key without prompting for the keychain password
+	_, err = k.security(ctx,
+		"set-key-partition-list",
+		"-S", "apple-tool:,apple:,codesign:",
+		"-s",
+		"-k", keychainPassword,
+		k.Path,
+	)
+	if err != nil {
+		return err
+	}
+
+	// codesign only finds identities in the keychains of the search list
+	out, err := k.security(ctx, "list-keychains", "-d", "user")
+	if err != nil {
+		return err
+	}
+	searchList := parseSearchList(out)
+
+	args := []string{"list-keychains", "-d", "user", "-s", k.Path}
+	if _, err := k.security(ctx, append(args, searchList...)...); err != nil {
+		return err
+	}
+	k.searchList = searchList
+
+	return nil
+}
+
+// Delete restores the keychain search list, deletes the keychain and
+// removes its temporary directory. It's safe to call more than once.
+// Pass a context that isn't done, such as context.Background(), to clean
+// up after a canceled run; only the command timeout then applies.
+func (k *Keychain) Delete(ctx context.Context) error {
+	var result error
+	if k.searchList != nil {
+		args := append([]string{"list-keychains", "-d", "user", "-s"}, k.searchList...)
+		if _, err := k.security(ctx, args...); err != nil {
+			k.logger.Warn("error restoring keychain search list", "err", err)
+			result = fmt.Errorf("error restoring keychain search list: %w", err)
+		}
+		k.searchList = nil
+	}
+
+	if k.dir == "" {
+		return result
+	}
+
+	if k.created {
+		if _, err := k.security(ctx, "delete-keychain", k.Path); err != nil {
+			k.logger.Warn("error deleting temporary keychain", "keychain", k.Path, "err", err)
+			if result == nil {
+				result = fmt.Errorf("error deleting keychain: %w", err)
+			}
+		}
+		k.created = false
+	}
+	if err := os.RemoveAll(k.dir); err != nil {
+		k.logger.Warn("error removing temporary keychain directory", "path", k.dir, "err", err)
+		if result == nil {
+			result = err
+		}
+	}
+	k.dir = ""
+
+	return result
+}
+
+// security runs the security binary with the given arguments and returns
+// its standard output.
+func (k *Keychain) security(ctx context.Context, args ...string) (string, error) {
+	return securitycmd.Run(ctx, &securitycmd.Options{
+		Logger:     k.logger,
+		Timeout:    k.opts.Timeout,
+		BaseCmd:    k.opts.BaseCmd,
+		Redact:     secret.Redact,
+		RedactArgs: secret.RedactArgs,
+	}, args...)
+}
+
+// parseSearchList parses the output of `security list-keychains`, one
+// quoted path per line.
+func parseSearchList(out string) []string {
+	result := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.Trim(strings.TrimSpace(line), `"`)
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+
+	return result
+}
+
+// decode decodes base64 content, ignoring line breaks and other white
+// space as in the output of `base64` and in PEM-like blocks.
+func decode(content string) ([]byte, error) {
+	cleaned := strings.Join(strings.Fields(content), "")
+	raw, err := base64.StdEncoding.DecodeString(cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("the .p12 content isn't base64 encoded: %w", err)
+	}
+	if len(raw) == 0 {
+		return nil, errors.New("the .p12 content is empty")
+	}
+
+	return raw, nil
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,248 @@
+package keychain
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// Set our default logger
+	logger := hclog.L()
+	logger.SetLevel(hclog.Trace)
+	hclog.SetDefault(logger)
+
+	// If we got a subcommand, run that
+	if v := os.Getenv(childEnv); v != "" && childCommands[v] != nil {
+		os.Exit(childCommands[v]())
+	}
+
+	os.Exit(m.Run())
+}
+
+// childEnv is the env var that must be set to trigger a child command.
+const childEnv = "GON_TEST_CHILD"
+
+// recordEnv is the env var with the path of the file the child commands
+// append their arguments to.
+const recordEnv = "GON_TEST_RECORD"
+
+// childCommands is the list of commands we support
+var childCommands = map[string]func() int{
+	"security":              testCmdSecurity,
+	"security-import-error": testCmdSecurityImportError,
+}
+
+// childCmd is used to create a command that executes a command in the
+// childCommands map in a new process. The arguments of every execution
+// are appended to record, one line each.
+func childCmd(t *testing.T, name, record string) *exec.Cmd {
+	t.Helper()
+
+	// Get the path to our executable
+	selfPath, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		t.Fatalf("error creating child command: %s", err)
+		return nil
+	}
+
+	cmd := exec.Command(selfPath)
+	cmd.Env = os.Environ()
+	cmd.Env = append(cmd.Env, childEnv+"="+name, recordEnv+"="+record)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd
+}
+
+func TestCreate(t *testing.T) {
+	td, err := ioutil.TempDir("", "gon")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+	record := filepath.Join(td, "record")
+
+	os.Setenv("GON_TEST_P12_PASSWORD", "hunter2")
+	defer os.Unsetenv("GON_TEST_P12_PASSWORD")
+
+	k, err := Create(context.Background(), &Options{
+		P12Content: base64.StdEncoding.EncodeToString([]byte("p12")),
+		Password:   "@env:GON_TEST_P12_PASSWORD",
+		Logger:     hclog.L(),
+		BaseCmd:    childCmd(t, "security", record),
+	})
+	require.NoError(t, err)
+
+	// The decoded content is imported from the keychain's directory
+	p12 := filepath.Join(filepath.Dir(k.Path), "identity.p12")
+	raw, err := ioutil.ReadFile(p12)
+	require.NoError(t, err)
+	require.Equal(t, "p12", string(raw))
+
+	require.NoError(t, k.Delete(context.Background()))
+	_, err = os.Stat(filepath.Dir(k.Path))
+	require.True(t, os.IsNotExist(err))
+
+	// Deleting again does nothing
+	require.NoError(t, k.Delete(context.Background()))
+
+	calls := readRecord(t, record)
+	require.Len(t, calls, 9)
+	require.Equal(t, "create-keychain -p", strings.Join(calls[0][:2], " "))
+	require.Equal(t, []string{"set-keychain-settings", k.Path}, calls[1])
+	require.Equal(t, "unlock-keychain", calls[2][0])
+	require.Equal(t, []string{
+		"import", p12,
+		"-k", k.Path,
+		"-f", "pkcs12",
+		"-P", "hunter2",
+		"-T", "/usr/bin/codesign",
+		"-T", "/usr/bin/security",
+	}, calls[3])
+	require.Equal(t, "set-key-partition-list", calls[4][0])
+	require.Equal(t, []string{"list-keychains", "-d", "user"}, calls[5])
+	require.Equal(t, []string{
+		"list-keychains", "-d", "user", "-s", k.Path,
+		"/Users/gon/Library/Keychains/login.keychain-db",
+	}, calls[6])
+	require.Equal(t, []string{
+		"list-keychains", "-d", "user", "-s",
+		"/Users/gon/Library/Keychains/login.keychain-db",
+	}, calls[7])
+	require.Equal(t, []string{"delete-keychain", k.Path}, calls[8])
+
+	// The keychain password is the same throughout
+	password := calls[0][2]
+	require.Equal(t, password, calls[2][2])
+	require.Equal(t, password, calls[4][5])
+}
+
+func TestCreate_importError(t *testing.T) {
+	td, err := ioutil.TempDir("", "gon")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+	record := filepath.Join(td, "record")
+
+	_, err = Create(context.Background(), &Options{
+		P12Path:  "identity.p12",
+		Password: "hunter2",
+		Logger:   hclog.L(),
+		BaseCmd:  childCmd(t, "security-import-error", record),
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error importing identity.p12")
+	require.Contains(t, err.Error(), "MAC verification failed")
+
+	// The keychain is deleted again, the search list was never changed
+	calls := readRecord(t, record)
+	require.Len(t, calls, 5)
+	require.Equal(t, "import", calls[3][0])
+	require.Equal(t, "delete-keychain", calls[4][0])
+}
+
+func TestCreate_redacted(t *testing.T) {
+	td, err := ioutil.TempDir("", "gon")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+	record := filepath.Join(td, "record")
+
+	// Short passwords are redacted as well
+	var logs bytes.Buffer
+	_, err = Create(context.Background(), &Options{
+		P12Path:  "identity.p12",
+		Password: "pw1",
+		Logger:   hclog.New(&hclog.LoggerOptions{Output: &logs, Level: hclog.Trace}),
+		BaseCmd:  childCmd(t, "security-import-error", record),
+	})
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "pw1")
+
+	calls := readRecord(t, record)
+	require.Contains(t, calls[3], "pw1")
+	require.Contains(t, logs.String(), "import")
+	require.NotContains(t, logs.String(), "pw1")
+}
+
+func TestCreate_invalidContent(t *testing.T) {
+	_, err := Create(context.Background(), &Options{
+		P12Content: "not base64!",
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "isn't base64 encoded")
+
+	_, err = Create(context.Background(), &Options{})
+	require.EqualError(t, err, "no .p12 file given")
+}
+
+func TestParseSearchList(t *testing.T) {
+	out := `    "/Users/gon/Library/Keychains/login.keychain-db"
+    "/Library/Keychains/System.keychain"
+`
+	require.Equal(t, []string{
+		"/Users/gon/Library/Keychains/login.keychain-db",
+		"/Library/Keychains/System.keychain",
+	}, parseSearchList(out))
+	require.Equal(t, []string{}, parseSearchList(""))
+}
+
+// readRecord returns the arguments of the recorded executions.
+func readRecord(t *testing.T, path string) [][]string {
+	t.Helper()
+
+	raw, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	var result [][]string
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		result = append(result, strings.Split(line, "\t"))
+	}
+
+	return result
+}
+
+// record appends the arguments of the child command to the record file.
+func record() {
+	f, err := os.OpenFile(os.Getenv(recordEnv), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	fmt.Fprintln(f, strings.Join(os.Args[1:], "\t"))
+}
+
+// testCmdSecurity mimicks security managing keychains.
+func testCmdSecurity() int {
+	record()
+
+	// Print the search list unless it's being set
+	if os.Args[1] == "list-keychains" && len(os.Args) == 4 {
+		fmt.Println(`    "/Users/gon/Library/Keychains/login.keychain-db"`)
+	}
+
+	return 0
+}
+
+// testCmdSecurityImportError mimicks security failing to import a .p12
+// file with the wrong password.
+func testCmdSecurityImportError() int {
+	record()
+
+	if os.Args[1] == "import" {
+		fmt.Fprintln(os.Stderr,
+			"security: SecKeychainItemImport: MAC verification failed during PKCS12 import (wrong password?)")
+		fmt.Fprintln(os.Stderr, "usage: security", strings.Join(os.Args[1:], " "))
+		return 1
+	}
+
+	return 0
+}
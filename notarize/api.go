@@ -0,0 +1,409 @@
+package notarize
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/bi-zone/gon/apikey"
+)
+
+// DefaultAPIBaseURL is the base URL of the Apple Notary web API.
+const DefaultAPIBaseURL = "https://appstoreconnect.apple.com/notary/v2"
+
+// API are the settings for talking to the Apple Notary web API directly
+// rather than executing `xcrun notarytool`. This makes it possible to
+// submit, poll and fetch logs from hosts that don't have Xcode installed.
+//
+// The Notary web API only supports App Store Connect API keys, so ApiKey
+// and ApiIssuer must be set in Options when API is used.
+type API struct {
+	// BaseURL is the base URL of the Notary web API. If this is empty then
+	// DefaultAPIBaseURL is used. This is mostly useful for tests.
+	BaseURL string
+
+	// StorageURL, if set, overrides the endpoint the file is uploaded to.
+	// By default the file is uploaded directly to the Amazon S3 bucket
+	// returned by the Notary API. If this is set, the file is uploaded
+	// path-style to "<StorageURL>/<bucket>/<object>" instead.
+	StorageURL string
+
+	// Client is the HTTP client to use. If this is nil then
+	// http.DefaultClient is used.
+	Client *http.Client
+
+	// Signer, if set, creates the tokens for authenticating with the
+	// Notary API. If this is nil, a signer is created on first use from
+	// the API key settings in Options and reused for later requests.
+	Signer *apikey.Signer
+
+	lock sync.Mutex
+}
+
+// storageRegion is the AWS region of the bucket the Notary API hands out
+// for uploads.
+const storageRegion = "us-west-2"
+
+// upload creates a new submission and uploads the file to the bucket
+// returned by the Notary API. It returns the submission ID which is used
+// as the request UUID for the rest of the process.
+func (a *API) upload(ctx context.Context, opts *Options) (string, error) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	// The submission requires the checksum of the file up front.
+	f, err := os.Open(opts.File)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	// Create the submission
+	logger.Info("creating notarization submission",
+		"file", opts.File,
+		"sha256", sum,
+	)
+	var sub apiSubmissionResponse
+	err = a.do(ctx, opts, http.MethodPost, "/submissions", &apiSubmissionRequest{
+		SubmissionName: filepath.Base(opts.File),
+		Sha256:         sum,
+	}, &sub)
+	if err != nil {
+		return "", fmt.Errorf("error creating notarization submission: %w", err)
+	}
+
+	attrs := sub.Data.Attributes
+	if sub.Data.Id == "" || attrs.Bucket == "" || attrs.Object == "" {
+		return "", fmt.Errorf(
+			"notarization submission appeared to succeed, but the response " +
+				"is missing the submission ID or the upload location. Please " +
+				"enable logging, try again, and report this as a bug")
+	}
+
+	// Upload the file itself
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	logger.Info("uploading file for notarization",
+		"request_id", sub.Data.Id,
+		"bucket", attrs.Bucket,
+		"object", attrs.Object,
+	)
+	err = a.store(ctx, &storageUpload{
+		Bucket:      attrs.Bucket,
+		Object:      attrs.Object,
+		Body:        f,
+		Size:        fi.Size(),
+		Sha256:      sum,
+		Credentials: attrs.storageCredentials(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error uploading file for notarization: %w", err)
+	}
+
+	logger.Info("notarization request submitted", "request_id", sub.Data.Id)
+	return sub.Data.Id, nil
+}
+
+// info requests the status of a submission from the Notary API.
+func (a *API) info(ctx context.Context, uuid string, opts *Options) (*Info, error) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	logger.Info("requesting notarization info", "uuid", uuid)
+
+	var resp apiSubmissionStatusResponse
+	if err := a.do(ctx, opts, http.MethodGet, "/submissions/"+uuid, nil, &resp); err != nil {
+		return nil, fmt.Errorf("error checking on notarization status: %w", err)
+	}
+
+	result := Info{
+		RequestUUID: resp.Data.Id,
+		Date:        resp.Data.Attributes.CreatedDate,
+		Name:        resp.Data.Attributes.Name,
+		Status:      resp.Data.Attributes.Status,
+	}
+
+	logger.Info("notarization info", "uuid", uuid, "info", result)
+	return &result, nil
+}
+
+// log fetches the developer log of a submission from the Notary API.
+func (a *API) log(ctx context.Context, uuid string, opts *Options) (*Log, error) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	logger.Info("requesting notarization log", "uuid", uuid)
+
+	var resp apiSubmissionLogResponse
+	if err := a.do(ctx, opts, http.MethodGet, "/submissions/"+uuid+"/logs", nil, &resp); err != nil {
+		return nil, fmt.Errorf("error requesting notarization log: %w", err)
+	}
+
+	logURL := resp.Data.Attributes.DeveloperLogUrl
+	if logURL == "" {
+		return nil, fmt.Errorf("notarization log response has no developer log URL")
+	}
+
+	// The developer log URL is pre-signed so it must be requested without
+	// our authorization header.
+	req, err := http.NewRequest(http.MethodGet, logURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	httpResp, err := a.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading notarization log: %w", networkError(ctx, err))
+	}
+	defer httpResp.Body.Close()
+
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading notarization log: %w", err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading notarization log: %s", httpResp.Status)
+	}
+
+	var result Log
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode notarization log: %w", err)
+	}
+
+	logger.Info("notarization log", "uuid", uuid, "info", result)
+	result.Raw = body
+	return &result, nil
+}
+
+// do performs an authorized request against the Notary API. If in is
+// non-nil it is sent as the JSON request body. If out is non-nil the
+// response body is decoded into it.
+func (a *API) do(ctx context.Context, opts *Options, method, path string, in, out interface{}) error {
+	token, err := a.token(opts)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequest(method, a.baseURL()+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.client().Do(req)
+	if err != nil {
+		return networkError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newAPIError(resp.StatusCode, raw)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("failed to decode Notary API response: %w", err)
+	}
+
+	return nil
+}
+
+// token returns a token for the next request, loading the API key from
+// the options the first time.
+func (a *API) token(opts *Options) (string, error) {
+	a.lock.Lock()
+	if a.Signer == nil {
+		if opts.ApiKey == "" || opts.ApiIssuer == "" {
+			a.lock.Unlock()
+			return "", fmt.Errorf("the Notary API requires api_key and api_issuer to be set")
+		}
+
+		var key *apikey.Key
+		var err error
+		if opts.ApiKeyPath == "" && opts.ApiKeyContent != "" {
+			key, err = apikey.ParseContent(opts.ApiKeyContent, opts.ApiKey, opts.ApiIssuer)
+		} else {
+			key, err = apikey.Load(opts.ApiKeyPath, opts.ApiKey, opts.ApiIssuer)
+		}
+		if err != nil {
+			a.lock.Unlock()
+			return "", err
+		}
+		a.Signer = &apikey.Signer{Key: key}
+	}
+	signer := a.Signer
+	a.lock.Unlock()
+
+	return signer.Token()
+}
+
+func (a *API) baseURL() string {
+	if a.BaseURL == "" {
+		return DefaultAPIBaseURL
+	}
+
+	return strings.TrimSuffix(a.BaseURL, "/")
+}
+
+func (a *API) client() *http.Client {
+	if a.Client == nil {
+		return http.DefaultClient
+	}
+
+	return a.Client
+}
+
+// APIError is an error response returned by the Notary web API.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+
+	// Errors are the errors listed in the response body, if any.
+	Errors []APIErrorDetail
+}
+
+// APIErrorDetail is a single error entry of a Notary API error response.
+type APIErrorDetail struct {
+	Id     string `json:"id"`
+	Status string `json:"status"`
+	Code   string `json:"code"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+func newAPIError(status int, body []byte) *APIError {
+	var resp struct {
+		Errors []APIErrorDetail `json:"errors"`
+	}
+
+	// The body is best-effort, we report the status either way.
+	_ = json.Unmarshal(body, &resp)
+	return &APIError{StatusCode: status, Errors: resp.Errors}
+}
+
+// Error implements error
+func (err *APIError) Error() string {
+	msg := fmt.Sprintf("Notary API returned %d %s", err.StatusCode, http.StatusText(err.StatusCode))
+	for _, e := range err.Errors {
+		msg += fmt.Sprintf("\n  * %s: %s", e.Title, e.Detail)
+	}
+
+	return msg
+}
+
+// Is matches the kind of failure of the status code, see ErrAuth,
+// ErrNotFound, ErrRateLimited and ErrNetwork.
+func (err *APIError) Is(target error) bool {
+	kind := statusKind(err.StatusCode)
+	return kind != nil && kind == target
+}
+
+// apiSubmissionRequest is the body for creating a new submission.
+type apiSubmissionRequest struct {
+	SubmissionName string `json:"submissionName"`
+	Sha256         string `json:"sha256"`
+}
+
+// apiSubmissionResponse is the response for creating a new submission.
+type apiSubmissionResponse struct {
+	Data struct {
+		Id         string                  `json:"id"`
+		Type       string                  `json:"type"`
+		Attributes apiSubmissionAttributes `json:"attributes"`
+	} `json:"data"`
+}
+
+// apiSubmissionAttributes holds the temporary credentials and location
+// for uploading the submitted file.
+type apiSubmissionAttributes struct {
+	AwsAccessKeyId     string `json:"awsAccessKeyId"`
+	AwsSecretAccessKey string `json:"awsSecretAccessKey"`
+	AwsSessionToken    string `json:"awsSessionToken"`
+	Bucket             string `json:"bucket"`
+	Object             string `json:"object"`
+}
+
+func (a apiSubmissionAttributes) storageCredentials() storageCredentials {
+	return storageCredentials{
+		AccessKeyId:     a.AwsAccessKeyId,
+		SecretAccessKey: a.AwsSecretAccessKey,
+		SessionToken:    a.AwsSessionToken,
+	}
+}
+
+// apiSubmissionStatusResponse is the response for a submission status.
+type apiSubmissionStatusResponse struct {
+	Data struct {
+		Id         string `json:"id"`
+		Type       string `json:"type"`
+		Attributes struct {
+			CreatedDate string `json:"createdDate"`
+			Name        string `json:"name"`
+			Status      string `json:"status"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// apiSubmissionLogResponse is the response for a submission log request.
+type apiSubmissionLogResponse struct {
+	Data struct {
+		Id         string `json:"id"`
+		Type       string `json:"type"`
+		Attributes struct {
+			DeveloperLogUrl string `json:"developerLogUrl"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
@@ -0,0 +1,162 @@
+package notarize
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// storageCredentials are the temporary AWS credentials handed out by the
+// Notary API for uploading a single submission.
+type storageCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// storageUpload describes a single object upload to the submission bucket.
+type storageUpload struct {
+	Bucket      string
+	Object      string
+	Body        io.Reader
+	Size        int64
+	Sha256      string
+	Credentials storageCredentials
+}
+
+// store uploads a file to the bucket returned by the Notary API. The
+// request is signed with AWS Signature Version 4 so we don't need to pull
+// in the whole AWS SDK for a single PUT.
+func (a *API) store(ctx context.Context, u *storageUpload) error {
+	url := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s",
+		u.Bucket, storageRegion, awsEscapePath(u.Object))
+	if a.StorageURL != "" {
+		url = fmt.Sprintf("%s/%s/%s",
+			strings.TrimSuffix(a.StorageURL, "/"), u.Bucket, awsEscapePath(u.Object))
+	}
+
+	req, err := http.NewRequest(http.MethodPut, url, ioutil.NopCloser(u.Body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = u.Size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Amz-Content-Sha256", u.Sha256)
+	if u.Credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", u.Credentials.SessionToken)
+	}
+	signV4(req, u.Credentials, storageRegion, "s3", time.Now())
+
+	resp, err := a.client().Do(req)
+	if err != nil {
+		return networkError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("storage returned %s:\n\n%s", resp.Status, body)
+	}
+
+	return nil
+}
+
+// signV4 signs the request in-place using AWS Signature Version 4. All
+// headers set on the request plus "Host" are signed. The request must
+// already have the "X-Amz-Content-Sha256" header set to the hex encoded
+// SHA-256 of the payload.
+func signV4(req *http.Request, creds storageCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	shortDate := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	// Canonical headers are lower case, sorted and trimmed.
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	scope := strings.Join([]string{shortDate, region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), shortDate)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		creds.AccessKeyId, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscapePath escapes an object key the way AWS expects it in both the
+// URL and the canonical request: every byte except the unreserved
+// characters is percent-encoded, and slashes are kept as-is.
+func awsEscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
@@ -1,12 +1,232 @@
 package notarize
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
 
 	"github.com/hashicorp/go-multierror"
+	"howett.net/plist"
+
+	"github.com/bi-zone/gon/secret"
+)
+
+// The kinds of notarization failures. The errors of this package match
+// one of these with errors.Is if the failure was recognized, whether it
+// was reported by notarytool or by the Notary web API.
+var (
+	// ErrAuth is an authentication failure: wrong credentials, or an
+	// API key that was revoked or lacks access.
+	ErrAuth = errors.New("authentication failed")
+
+	// ErrTwoFactor is the "unable to create an authentication session"
+	// (-22016) failure. It usually means an Apple ID password was used
+	// where an app-specific password is required.
+	ErrTwoFactor = errors.New("unable to create an authentication session")
+
+	// ErrNotFound is a request UUID the service doesn't know, either
+	// because the submission is still queued or because it belongs to
+	// another team.
+	ErrNotFound = errors.New("submission not found")
+
+	// ErrNetwork is a failure to reach the service.
+	ErrNetwork = errors.New("network unavailable")
+
+	// ErrRateLimited is a request that was rejected because too many
+	// requests were made.
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrInvalidPackage is a file that can't be notarized, either because
+	// notarytool doesn't accept it or because Apple rejected it, see
+	// InvalidError.
+	ErrInvalidPackage = errors.New("invalid package")
 )
 
+// toolErrorPatterns classify notarytool output, see classify. They match
+// notarytool's own messages and the codes of the errors it reports, not
+// words that could be in other messages too, such as the name of a file.
+// The patterns are matched case-insensitively in order, so the more
+// specific come first.
+var toolErrorPatterns = []struct {
+	kind     error
+	patterns []*regexp.Regexp
+}{
+	{ErrTwoFactor, []*regexp.Regexp{
+		regexp.MustCompile(`\(-22016\)`),
+		regexp.MustCompile(`unable to create an authentication session`),
+	}},
+	{ErrRateLimited, []*regexp.Regexp{
+		regexp.MustCompile(`http status code: 429\b`),
+	}},
+	{ErrAuth, []*regexp.Regexp{
+		regexp.MustCompile(`http status code: 40[13]\b`),
+		regexp.MustCompile(`unable to authenticate\. invalid credentials`),
+	}},
+	{ErrNotFound, []*regexp.Regexp{
+		regexp.MustCompile(`http status code: 404\b`),
+		regexp.MustCompile(`submission does not exist or does not belong to your team`),
+		regexp.MustCompile(`could not find the requestuuid`),
+		regexp.MustCompile(`\(1519\)`),
+	}},
+	{ErrNetwork, []*regexp.Regexp{
+		regexp.MustCompile(`error domain=nsurlerrordomain code=-\d+`),
+		regexp.MustCompile(`\(-19000\)`),
+	}},
+	{ErrInvalidPackage, []*regexp.Regexp{
+		regexp.MustCompile(`invalid file extension\. only zip, dmg and pkg files are supported`),
+	}},
+}
+
+// classify returns the kind of failure described by the output of
+// notarytool, nil if it isn't recognized.
+func classify(output string) error {
+	output = strings.ToLower(output)
+	for _, p := range toolErrorPatterns {
+		for _, pattern := range p.patterns {
+			if pattern.MatchString(output) {
+				return p.kind
+			}
+		}
+	}
+
+	return nil
+}
+
+// ToolError is a failure reported by notarytool. It matches its Kind with
+// errors.Is.
+type ToolError struct {
+	// Kind is the kind of failure, one of the Err variables of this
+	// package, or nil if it wasn't recognized.
+	Kind error
+
+	// Command is the notarytool command that failed: "submit", "info",
+	// "log" or "store-credentials".
+	Command string
+
+	// Message is the error message reported by notarytool.
+	Message string
+
+	// Output is the whole output of the command.
+	Output string
+}
+
+// newToolError returns the error for a failed notarytool command. The
+// message is decoded from the structured output if there is one, and is
+// the combined output of the command otherwise. Secrets are redacted.
+func newToolError(command, out, combined string) *ToolError {
+	out, combined = secret.Redact(out), secret.Redact(combined)
+
+	var msg struct {
+		Message string `plist:"message" json:"message"`
+	}
+	if _, err := plist.Unmarshal([]byte(out), &msg); err != nil {
+		json.Unmarshal([]byte(out), &msg)
+	}
+	if msg.Message == "" {
+		msg.Message = strings.TrimSpace(combined)
+	}
+
+	return &ToolError{
+		Kind:    classify(combined),
+		Command: command,
+		Message: msg.Message,
+		Output:  combined,
+	}
+}
+
+// Error implements error
+func (err *ToolError) Error() string {
+	what := "error checking on notarization status"
+	switch err.Command {
+	case "submit":
+		what = "error submitting for notarization"
+	case "store-credentials":
+		what = "error storing notarization credentials"
+	}
+
+	return fmt.Sprintf("%s:\n\n%s", what, err.Message)
+}
+
+// Unwrap returns the kind of failure.
+func (err *ToolError) Unwrap() error {
+	return err.Kind
+}
+
+// InvalidError is returned by Notarize when Apple rejected the file. The
+// log lists the issues that were found. It matches ErrInvalidPackage with
+// errors.Is.
+type InvalidError struct {
+	Info *Info
+	Log  *Log
+}
+
+// Error implements error
+func (err *InvalidError) Error() string {
+	if err.Log == nil || err.Log.StatusSummary == "" {
+		return "package is invalid."
+	}
+
+	return fmt.Sprintf("package is invalid: %s", err.Log.StatusSummary)
+}
+
+// Is reports the error as ErrInvalidPackage.
+func (err *InvalidError) Is(target error) bool {
+	return target == ErrInvalidPackage
+}
+
+// kindError gives an error a kind, see the Err variables. It matches the
+// kind with errors.Is and unwraps to the original error.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+// networkError marks an error making an HTTP request as ErrNetwork, unless
+// it's because ctx is done.
+func networkError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+
+	return &kindError{kind: ErrNetwork, err: err}
+}
+
+// statusKind returns the kind of failure for an HTTP status code of the
+// Notary web API, nil if it's not one of them.
+func statusKind(status int) error {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAuth
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrNetwork
+	}
+
+	return nil
+}
+
 // Error is the error structure generated by the notarization tool.
+//
+// Deprecated: notarytool failures are returned as *ToolError.
 type Error struct {
 	Code     int64             `plist:"code"`
 	Message  string            `plist:"message"`
@@ -14,6 +234,8 @@ type Error struct {
 }
 
 // Errors is a list of error and also implements error.
+//
+// Deprecated: notarytool failures are returned as *ToolError.
 type Errors []Error
 
 // Error implements error
@@ -0,0 +1,173 @@
+package notarize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	childCommands["info-auth"] = testCmdInfoAuth
+	childCommands["info-not-found"] = testCmdInfoNotFound
+	childCommands["upload-two-factor"] = testCmdUploadTwoFactor
+	childCommands["notarytool-queued"] = testCmdNotarytoolQueued
+}
+
+// queuedStateEnv is the file testCmdNotarytoolQueued counts its calls in.
+const queuedStateEnv = "GON_TEST_QUEUED_STATE"
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		Output string
+		Kind   error
+	}{
+		{"Error: HTTP status code: 401. Unable to authenticate. Invalid credentials.", ErrAuth},
+		{"We are unable to create an authentication session. (-22016)", ErrTwoFactor},
+		{"Error: Submission does not exist or does not belong to your team.", ErrNotFound},
+		{"Error: HTTP status code: 404. Resource not found.", ErrNotFound},
+		{"Error Domain=NSURLErrorDomain Code=-1009 \"The Internet connection appears to be offline.\"", ErrNetwork},
+		{"Error: HTTP status code: 429. Too many requests.", ErrRateLimited},
+		{"Error: Invalid file extension. Only zip, dmg and pkg files are supported.", ErrInvalidPackage},
+		{"Error: something else", nil},
+
+		// Words of the patterns in other messages
+		{"Error: \"foo\" is not a valid UUID.", nil},
+		{"Error: You are not authorized to read /tmp/rate limit/app.zip.", nil},
+		{"Error: The request timed out while hashing app.zip.", nil},
+		{"Error: Could not connect to the server-22016.zip.", nil},
+		{"Error: Unsupported file in HTTP status code: 4011.zip.", nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Output, func(t *testing.T) {
+			require.Equal(t, tc.Kind, classify(tc.Output))
+		})
+	}
+}
+
+func TestInfo_authError(t *testing.T) {
+	_, err := info(context.Background(), "foo", &Options{
+		DeveloperId: "foo@example.com",
+		Password:    "bar",
+		Logger:      hclog.L(),
+		BaseCmd:     childCmd(t, "info-auth"),
+	})
+
+	require := require.New(t)
+	require.True(errors.Is(err, ErrAuth))
+
+	var terr *ToolError
+	require.True(errors.As(err, &terr))
+	require.Equal("info", terr.Command)
+	require.True(strings.HasPrefix(terr.Message, "Error: HTTP status code: 401."))
+}
+
+func TestUpload_twoFactor(t *testing.T) {
+	_, err := upload(context.Background(), &Options{
+		DeveloperId: "foo@example.com",
+		Password:    "bar",
+		Logger:      hclog.L(),
+		BaseCmd:     childCmd(t, "upload-two-factor"),
+	})
+
+	require := require.New(t)
+	require.True(errors.Is(err, ErrTwoFactor))
+
+	var terr *ToolError
+	require.True(errors.As(err, &terr))
+	require.Equal("We are unable to create an authentication session. (-22016)", terr.Message)
+}
+
+func TestNotarize_queued(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gon")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cmd := childCmd(t, "notarytool-queued")
+	cmd.Env = append(cmd.Env, queuedStateEnv+"="+filepath.Join(dir, "calls"))
+
+	// The request isn't found until it leaves the queue
+	interval := time.Millisecond
+	info, log, err := Notarize(context.Background(), &Options{
+		DeveloperId:     "foo@example.com",
+		Password:        "bar",
+		Logger:          hclog.L(),
+		BaseCmd:         cmd,
+		RequestUUID:     "32684f68-d63e-49ba-9234-25eeec84b369",
+		PollingInterval: &interval,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Accepted", info.Status)
+	require.Equal(t, "Accepted", log.Status)
+}
+
+func TestNotarize_authError(t *testing.T) {
+	// Authentication failures aren't retried
+	interval := time.Millisecond
+	_, _, err := Notarize(context.Background(), &Options{
+		DeveloperId:     "foo@example.com",
+		Password:        "bar",
+		Logger:          hclog.L(),
+		BaseCmd:         childCmd(t, "info-auth"),
+		RequestUUID:     "32684f68-d63e-49ba-9234-25eeec84b369",
+		PollingInterval: &interval,
+	})
+	require.True(t, errors.Is(err, ErrAuth))
+}
+
+// testCmdInfoAuth mimicks notarytool with invalid credentials.
+func testCmdInfoAuth() int {
+	fmt.Fprintln(os.Stderr, "Error: HTTP status code: 401. Unable to authenticate. Invalid credentials. "+
+		"Username or password is incorrect. Use the app-specific password generated at appleid.apple.com.")
+	return 1
+}
+
+// testCmdInfoNotFound mimicks notarytool with a request that is still queued.
+func testCmdInfoNotFound() int {
+	fmt.Println(`{"message":"Error: Submission does not exist or does not belong to your team."}`)
+	return 69
+}
+
+// testCmdUploadTwoFactor mimicks notarytool with an Apple ID password that
+// isn't app-specific.
+func testCmdUploadTwoFactor() int {
+	fmt.Println(strings.TrimSpace(`
+<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+		<key>message</key>
+		<string>We are unable to create an authentication session. (-22016)</string>
+</dict>
+</plist>
+`))
+	return 1
+}
+
+// testCmdNotarytoolQueued mimicks notarytool for a request that isn't found
+// by the first two info requests and is accepted after.
+func testCmdNotarytoolQueued() int {
+	path := os.Getenv(queuedStateEnv)
+	raw, _ := ioutil.ReadFile(path)
+	calls, _ := strconv.Atoi(string(raw))
+	ioutil.WriteFile(path, []byte(strconv.Itoa(calls+1)), 0644)
+
+	switch {
+	case os.Args[2] == "log":
+		return testCmdLogValidSubmission()
+	case calls < 2:
+		return testCmdInfoNotFound()
+	default:
+		return testCmdInfoAcceptedSubmission()
+	}
+}
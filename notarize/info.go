@@ -9,6 +9,9 @@ import (
 	"path/filepath"
 
 	"github.com/hashicorp/go-hclog"
+
+	"github.com/bi-zone/gon/internal/execctx"
+	"github.com/bi-zone/gon/secret"
 	"howett.net/plist"
 )
 
@@ -37,6 +40,19 @@ type Info struct {
 	StatusMessage string `plist:"message"`
 }
 
+// RequestInfo returns the information about the notarization request with
+// the given UUID, e.g. to check on a request submitted earlier. The File
+// and Status options are ignored.
+func RequestInfo(ctx context.Context, uuid string, opts *Options) (*Info, error) {
+	opts, removeKey, err := opts.withKeyFile()
+	if err != nil {
+		return nil, err
+	}
+	defer removeKey()
+
+	return info(ctx, uuid, opts)
+}
+
 // info requests the information about a notarization and returns
 // the updated information.
 func info(ctx context.Context, uuid string, opts *Options) (*Info, error) {
@@ -45,6 +61,11 @@ func info(ctx context.Context, uuid string, opts *Options) (*Info, error) {
 		logger = hclog.NewNullLogger()
 	}
 
+	// If we're talking to the Notary API directly, there is no command to run
+	if opts.API != nil {
+		return opts.API.info(ctx, uuid, opts)
+	}
+
 	// Build our command
 	var cmd exec.Cmd
 	if opts.BaseCmd != nil {
@@ -72,14 +93,15 @@ func info(ctx context.Context, uuid string, opts *Options) (*Info, error) {
 		cmd.Args = append(cmd.Args, "--team-id", opts.Provider)
 	}
 
-	auth, err := opts.AuthArgs()
+	auth, err := opts.authArgs(ctx)
 	if err != nil {
 		return nil, err
 	}
 	cmd.Args = append(cmd.Args, auth...)
 
 	// We store all output in out for logging and in case there is an error
-	var out, combined bytes.Buffer
+	var out bytes.Buffer
+	var combined lockedBuffer
 	cmd.Stdout = io.MultiWriter(&out, &combined)
 	cmd.Stderr = &combined
 
@@ -87,20 +109,29 @@ func info(ctx context.Context, uuid string, opts *Options) (*Info, error) {
 	logger.Info("requesting notarization info",
 		"uuid", uuid,
 		"command_path", cmd.Path,
-		"command_args", cmd.Args,
+		"command_args", secret.RedactArgs(cmd.Args),
 	)
 
 	// Execute
-	err = cmd.Run()
+	err = execctx.Run(ctx, &cmd, opts.CommandTimeout)
 
 	// Log the result
 	logger.Info("notarization info command finished",
-		"output", out.String(),
+		"output", secret.Redact(out.String()),
 		"err", err,
 	)
 
-	// If we have any output, try to decode that since even in the case of
-	// an error it will output some information.
+	// If the command was stopped the output is incomplete
+	if execctx.Stopped(err) {
+		return nil, err
+	}
+
+	// notarytool reports failures in its output, so it is only decoded
+	// as a result if the command succeeded.
+	if err != nil {
+		return nil, newToolError("info", out.String(), combined.String())
+	}
+
 	var result Info
 	if out.Len() > 0 {
 		if _, perr := plist.Unmarshal(out.Bytes(), &result); perr != nil {
@@ -108,11 +139,6 @@ func info(ctx context.Context, uuid string, opts *Options) (*Info, error) {
 		}
 	}
 
-	// Now we check the error for actually running the process
-	if err != nil {
-		return nil, fmt.Errorf("error checking on notarization status:\n\n%s", combined.String())
-	}
-
 	logger.Info("notarization info", "uuid", uuid, "info", result)
 	return &result, nil
 }
@@ -10,6 +10,9 @@ import (
 	"path/filepath"
 
 	"github.com/hashicorp/go-hclog"
+
+	"github.com/bi-zone/gon/internal/execctx"
+	"github.com/bi-zone/gon/secret"
 )
 
 // Log Retrieves notarization log for a single completed submission
@@ -23,6 +26,10 @@ type Log struct {
 	SHA256          string             `json:"sha256"`
 	Issues          []LogIssue         `json:"issues"`
 	TicketContents  []LogTicketContent `json:"ticketContents"`
+
+	// Raw is the log as returned by Apple. It has more fields than are
+	// decoded here.
+	Raw []byte `json:"-"`
 }
 
 // LogIssue is a single issue that may have occurred during notarization.
@@ -32,6 +39,31 @@ type LogIssue struct {
 	Message  string `json:"message"`
 }
 
+// LogFileIssues are the issues of a single file, see Log.IssuesByPath.
+type LogFileIssues struct {
+	Path   string
+	Issues []LogIssue
+}
+
+// IssuesByPath returns the issues of the log grouped by the file they
+// are about, in the order the files first appear in the log.
+func (l *Log) IssuesByPath() []LogFileIssues {
+	var result []LogFileIssues
+	index := map[string]int{}
+	for _, issue := range l.Issues {
+		i, ok := index[issue.Path]
+		if !ok {
+			i = len(result)
+			index[issue.Path] = i
+			result = append(result, LogFileIssues{Path: issue.Path})
+		}
+
+		result[i].Issues = append(result[i].Issues, issue)
+	}
+
+	return result
+}
+
 // LogTicketContent is an entry that was noted as being within the archive.
 type LogTicketContent struct {
 	Path            string `json:"path"`
@@ -40,6 +72,19 @@ type LogTicketContent struct {
 	Arch            string `json:"arch"`
 }
 
+// RequestLog returns the notarization log of the request with the given
+// UUID. The log is only available once the request is processed. The File
+// and Status options are ignored.
+func RequestLog(ctx context.Context, uuid string, opts *Options) (*Log, error) {
+	opts, removeKey, err := opts.withKeyFile()
+	if err != nil {
+		return nil, err
+	}
+	defer removeKey()
+
+	return log(ctx, uuid, opts)
+}
+
 // log requests the information about a notarization and returns
 // the updated information.
 func log(ctx context.Context, uuid string, opts *Options) (*Log, error) {
@@ -48,6 +93,11 @@ func log(ctx context.Context, uuid string, opts *Options) (*Log, error) {
 		logger = hclog.NewNullLogger()
 	}
 
+	// If we're talking to the Notary API directly, there is no command to run
+	if opts.API != nil {
+		return opts.API.log(ctx, uuid, opts)
+	}
+
 	// Build our command
 	var cmd exec.Cmd
 	if opts.BaseCmd != nil {
@@ -74,14 +124,15 @@ func log(ctx context.Context, uuid string, opts *Options) (*Log, error) {
 		cmd.Args = append(cmd.Args, "--team-id", opts.Provider)
 	}
 
-	auth, err := opts.AuthArgs()
+	auth, err := opts.authArgs(ctx)
 	if err != nil {
 		return nil, err
 	}
 	cmd.Args = append(cmd.Args, auth...)
 
 	// We store all output in out for logging and in case there is an error
-	var out, combined bytes.Buffer
+	var out bytes.Buffer
+	var combined lockedBuffer
 	cmd.Stdout = io.MultiWriter(&out, &combined)
 	cmd.Stderr = &combined
 
@@ -89,34 +140,38 @@ func log(ctx context.Context, uuid string, opts *Options) (*Log, error) {
 	logger.Info("requesting notarization log",
 		"uuid", uuid,
 		"command_path", cmd.Path,
-		"command_args", cmd.Args,
+		"command_args", secret.RedactArgs(cmd.Args),
 	)
 
 	// Execute
-	err = cmd.Run()
+	err = execctx.Run(ctx, &cmd, opts.CommandTimeout)
 
 	// Log the result
 	logger.Info("notarization log command finished",
-		"output", out.String(),
+		"output", secret.Redact(out.String()),
 		"err", err,
 	)
 
-	// If we have any output, try to decode that since even in the case of
-	// an error it will output some information.
+	// If the command was stopped the output is incomplete
+	if execctx.Stopped(err) {
+		return nil, err
+	}
+
+	// notarytool reports failures in its output, so it is only decoded
+	// as a result if the command succeeded.
+	if err != nil {
+		return nil, newToolError("log", out.String(), combined.String())
+	}
+
 	var result Log
 	// return &result, json.NewDecoder().Decode(&result)
 	if out.Len() > 0 {
 		if derr := json.Unmarshal(out.Bytes(), &result); derr != nil {
 			return nil, fmt.Errorf("failed to decode notarization submission output: %w", derr)
-
 		}
 	}
 
-	// Now we check the error for actually running the process
-	if err != nil {
-		return nil, fmt.Errorf("error checking on notarization status:\n\n%s", combined.String())
-	}
-
 	logger.Info("notarization log", "uuid", uuid, "info", result)
+	result.Raw = out.Bytes()
 	return &result, nil
 }
@@ -17,8 +17,10 @@ func init() {
 
 func TestLog_accepted(t *testing.T) {
 	log, err := log(context.Background(), "foo", &Options{
-		Logger:  hclog.L(),
-		BaseCmd: childCmd(t, "log-accepted"),
+		DeveloperId: "foo@example.com",
+		Password:    "bar",
+		Logger:      hclog.L(),
+		BaseCmd:     childCmd(t, "log-accepted"),
 	})
 
 	require := require.New(t)
@@ -32,8 +34,10 @@ func TestLog_accepted(t *testing.T) {
 
 func TestLog_invalid(t *testing.T) {
 	log, err := log(context.Background(), "foo", &Options{
-		Logger:  hclog.L(),
-		BaseCmd: childCmd(t, "log-invalid"),
+		DeveloperId: "foo@example.com",
+		Password:    "bar",
+		Logger:      hclog.L(),
+		BaseCmd:     childCmd(t, "log-invalid"),
 	})
 
 	require := require.New(t)
@@ -43,6 +47,24 @@ func TestLog_invalid(t *testing.T) {
 	require.Equal(log.StatusSummary, "Archive contains critical validation errors")
 	require.Equal(len(log.TicketContents), 0)
 	require.Equal(len(log.Issues), 3)
+
+	files := log.IssuesByPath()
+	require.Len(files, 1)
+	require.Equal("gon.zip/foo", files[0].Path)
+	require.Len(files[0].Issues, 3)
+}
+
+func TestLog_issuesByPath(t *testing.T) {
+	log := &Log{Issues: []LogIssue{
+		{Severity: "error", Path: "a.zip/b", Message: "one"},
+		{Severity: "error", Path: "a.zip/a", Message: "two"},
+		{Severity: "warning", Path: "a.zip/b", Message: "three"},
+	}}
+
+	require.Equal(t, []LogFileIssues{
+		{Path: "a.zip/b", Issues: []LogIssue{log.Issues[0], log.Issues[2]}},
+		{Path: "a.zip/a", Issues: []LogIssue{log.Issues[1]}},
+	}, log.IssuesByPath())
 }
 
 // testCmdLogValidSubmission mimicks an accepted submission.
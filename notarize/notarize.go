@@ -2,17 +2,18 @@
 package notarize
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"os"
 	"os/exec"
-	"os/user"
-	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
+
+	"github.com/bi-zone/gon/apikey"
+	"github.com/bi-zone/gon/secret"
 )
 
 // Options are the options for notarization.
@@ -24,8 +25,9 @@ type Options struct {
 	DeveloperId string
 
 	// Password is your Apple Connect password. This must be specified.
-	// This also supports `@keychain:<value>` and `@env:<value>` formats to
-	// read from the keychain and environment variables, respectively.
+	// This also supports `@keychain:<value>`, `@env:<value>` and
+	// `@file:<path>` formats to read from the keychain, environment
+	// variables and files, respectively. See the secret package.
 	Password string
 
 	// Provider is the Apple Connect provider to use. This is optional
@@ -43,6 +45,19 @@ type Options struct {
 	// ApiIssuer is the ID of the specified ApiKey Issuer. Required if ApiKey is specified.
 	ApiIssuer string
 
+	// ApiKeyContent is the content of the `.p8` file, as is or base64
+	// encoded, as an alternative to ApiKeyPath for keys that aren't on
+	// disk. Notarize, RequestInfo, RequestLog and StoreCredentials write
+	// it to a temporary file only the user can read while they run and
+	// remove it when they return. ApiKeyPath takes precedence.
+	ApiKeyContent string
+
+	// KeychainProfile is the name of a notarytool keychain profile to
+	// authenticate with, as created by `notarytool store-credentials` or
+	// StoreCredentials. It takes precedence over the other credentials.
+	// The Notary web API doesn't support it.
+	KeychainProfile string
+
 	// UploadLock, if specified, will limit concurrency when uploading
 	// packages. The notary submission process does not allow concurrent
 	// uploads of packages with the same bundle ID, it appears. If you set
@@ -56,28 +71,76 @@ type Options struct {
 	// Logger is the logger to use. If this is nil then no logging will be done.
 	Logger hclog.Logger
 
+	// CommandTimeout, if positive, limits how long each notarytool execution
+	// may run. It doesn't apply to the web API, see API.Client instead.
+	CommandTimeout time.Duration
+
 	// BaseCmd is the base command for executing app submission. This is
 	// used for tests to overwrite where the codesign binary is. If this isn't
 	// specified then we use `xcrun notarytool` as the base.
 	BaseCmd *exec.Cmd
 
+	// SecurityCmd is the base command for executing the security binary to
+	// read `@keychain:` passwords and manage the keychain of
+	// TemporaryProfile. This is used for tests to overwrite where the
+	// security binary is.
+	SecurityCmd *exec.Cmd
+
+	// TemporaryProfile, if true, keeps the Apple ID password off the
+	// command line of the notarytool commands Notarize runs, where any
+	// user could see it with ps. The credentials are stored in a notarytool
+	// keychain profile in a temporary keychain when they are first needed,
+	// and the keychain is deleted when Notarize returns. This is ignored
+	// for keychain profile and API key authentication.
+	TemporaryProfile bool
+
+	// API, if non-nil, makes notarization talk to the Apple Notary web API
+	// directly instead of executing `xcrun notarytool`. BaseCmd is ignored
+	// in this case. The web API only supports API key authentication.
+	API *API
+
+	// RequestUUID, if set, is the UUID of a request the file was already
+	// submitted with, e.g. by an earlier run that was interrupted. The file
+	// isn't uploaded again and Notarize only waits for the result.
+	RequestUUID string
+
 	// PollingInterval defines how often `gon` will poll the notarization status.
 	// Apple Connect API has some kind of opaque (at least when we use altool)
 	// rate limiting so try to set the interval reasonable low. If `nil` --
 	// default interval will be used.
 	PollingInterval *time.Duration
+
+	// passwordResolved is true if Password is already the secret rather
+	// than a reference to it, see resolvePassword.
+	passwordResolved bool
+
+	// profile, if non-nil, is the temporary profile to authenticate with
+	// instead of the Apple ID and password, see TemporaryProfile.
+	profile *profile
 }
 
 // AuthArgs returns `xcrun notarytool` authentication arguments using provided
-// `Username+Password` or `ApiKey+ApiIssuer`. API authentication takes
-// precedence over password authentication. Returns error when can't select
-// an authentication method.
+// `KeychainProfile`, `Username+Password` or `ApiKey+ApiIssuer`. A keychain
+// profile takes precedence over API authentication, which takes precedence
+// over password authentication. Returns error when can't select an
+// authentication method or the password reference can't be resolved.
 func (o Options) AuthArgs() ([]string, error) {
+	return o.authArgs(context.Background())
+}
+
+// authArgs is AuthArgs resolving the password with ctx.
+func (o Options) authArgs(ctx context.Context) ([]string, error) {
 	switch {
+	case o.KeychainProfile != "":
+		return []string{"--keychain-profile", o.KeychainProfile}, nil
 	case o.ApiKey != "" && o.ApiIssuer != "":
+		if o.ApiKeyPath == "" && o.ApiKeyContent != "" {
+			return nil, fmt.Errorf("the API key content must be written to a file first. " +
+				"Please specify api_key_path")
+		}
 		if o.ApiKeyPath == "" {
 			var err error
-			o.ApiKeyPath, err = guessApiKeyFile(o.ApiKey)
+			o.ApiKeyPath, err = apikey.Find(o.ApiKey)
 			if err != nil {
 				return nil, fmt.Errorf("%w. %s",
 					err, "Please specify api_key_path or put a key into default altool location")
@@ -89,16 +152,77 @@ func (o Options) AuthArgs() ([]string, error) {
 			"--key", o.ApiKeyPath,
 		}, nil
 	case o.DeveloperId != "" && o.Password != "":
+		if o.profile != nil {
+			return o.profile.args(ctx, &o)
+		}
+
+		resolved, err := o.resolvePassword(ctx)
+		if err != nil {
+			return nil, err
+		}
 		return []string{
-			"--apple-id", o.DeveloperId,
-			"--password", o.Password,
+			"--apple-id", resolved.DeveloperId,
+			"--password", resolved.Password,
 		}, nil
 	default:
 		return nil, fmt.Errorf("no authorization info given. " +
-			"Please specify Apple username + password or api_key + api_issuer")
+			"Please specify keychain_profile, Apple username + password or api_key + api_issuer")
 	}
 }
 
+// resolvePassword returns the options with the password resolved if it's
+// a reference to a secret, and the options as is otherwise. Resolving it
+// once up front avoids reading the keychain for every command.
+func (o *Options) resolvePassword(ctx context.Context) (*Options, error) {
+	if o.passwordResolved {
+		return o, nil
+	}
+	if !secret.IsReference(o.Password) {
+		// A password given as is must be kept out of logs just the same
+		secret.Register(o.Password)
+		return o, nil
+	}
+
+	// Keychain profile and API key authentication don't need the password
+	if o.KeychainProfile != "" || o.API != nil || (o.ApiKey != "" && o.ApiIssuer != "") {
+		return o, nil
+	}
+
+	password, err := secret.Resolve(ctx, o.Password, &secret.Options{
+		Logger:  o.Logger,
+		Timeout: o.CommandTimeout,
+		BaseCmd: o.SecurityCmd,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := *o
+	result.Password = password
+	result.passwordResolved = true
+	return &result, nil
+}
+
+// withKeyFile returns the options with ApiKeyContent written to a temporary
+// key file for notarytool, and a function that removes the file. It must be
+// called on every path, so it's deferred. The options are returned as is if
+// there is no file to write.
+func (o *Options) withKeyFile() (*Options, func(), error) {
+	if o.ApiKeyContent == "" || o.ApiKeyPath != "" || o.API != nil ||
+		o.KeychainProfile != "" || o.ApiKey == "" || o.ApiIssuer == "" {
+		return o, func() {}, nil
+	}
+
+	path, remove, err := apikey.WriteTemp(o.ApiKeyContent, o.ApiKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := *o
+	result.ApiKeyPath = path
+	return &result, remove, nil
+}
+
 // Notarize performs the notarization process for macOS applications. This
 // will block for the duration of this process which can take many minutes.
 // The Status field in Options can be used to get status change notifications.
@@ -130,31 +254,66 @@ func Notarize(ctx context.Context, opts *Options) (*Info, *Log, error) {
 		pollInterval = *opts.PollingInterval
 	}
 
-	// First perform the upload
-	lock.Lock()
-	status.Submitting()
-	uuid, err := upload(ctx, opts)
-	lock.Unlock()
+	// Resolve the password once rather than for every command
+	opts, err := opts.resolvePassword(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
+
+	// notarytool only takes the API key as a file
+	opts, removeKey, err := opts.withKeyFile()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer removeKey()
+
+	// Authenticate with a temporary profile rather than the password
+	if opts.TemporaryProfile && opts.profile == nil && opts.API == nil &&
+		opts.KeychainProfile == "" && (opts.ApiKey == "" || opts.ApiIssuer == "") {
+		p := &profile{}
+		defer p.remove(opts)
+
+		withProfile := *opts
+		withProfile.profile = p
+		opts = &withProfile
+	}
+
+	// First perform the upload, unless it was already done
+	uuid := opts.RequestUUID
+	if uuid == "" {
+		var err error
+		lock.Lock()
+		status.Submitting()
+		uuid, err = upload(ctx, opts)
+		lock.Unlock()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 	status.Submitted(uuid)
 
 	// Begin polling the info. The first thing we wait for is for the status
-	// _to even exist_. While we get an error requesting info with an error
-	// code of 1519 (UUID not found), then we are stuck in a queue. Sometimes
-	// this queue is hours long. We just have to wait.
+	// _to even exist_. While the request UUID is not found, we are stuck in
+	// a queue. Sometimes this queue is hours long. We just have to wait.
 	infoResult := &Info{RequestUUID: uuid}
 	for {
-		time.Sleep(pollInterval)
+		if err := sleep(ctx, pollInterval); err != nil {
+			return infoResult, nil, err
+		}
+
 		_, err := info(ctx, infoResult.RequestUUID, opts)
 		if err == nil {
 			break
 		}
 
-		// If we got error code 1519 that means that the UUID was not found.
-		// This means we're in a queue.
-		if e, ok := err.(Errors); ok && e.ContainsCode(1519) {
+		// If the UUID was not found we're in a queue.
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+
+		// Network trouble and rate limiting pass, so we keep waiting.
+		if retryable(err) {
+			logger.Warn("error requesting notarization info, will retry", "err", err)
 			continue
 		}
 
@@ -174,10 +333,15 @@ func Notarize(ctx context.Context, opts *Options) (*Info, *Log, error) {
 		}
 
 		if err != nil {
-			// This code is the network became unavailable error. If this
-			// happens then we just log and retry.
-			if e, ok := err.(Errors); ok && e.ContainsCode(-19000) {
-				logger.Warn("error that network became unavailable, will retry")
+			// If the network became unavailable or we're rate limited we
+			// just log and retry. Rate limiting waits for another interval.
+			if retryable(err) {
+				logger.Warn("error requesting notarization info, will retry", "err", err)
+				if errors.Is(err, ErrRateLimited) {
+					if err := sleep(ctx, pollInterval); err != nil {
+						return infoResult, nil, err
+					}
+				}
 				goto RETRYINFO
 			}
 
@@ -187,14 +351,16 @@ func Notarize(ctx context.Context, opts *Options) (*Info, *Log, error) {
 		status.InfoStatus(*infoResult)
 
 		// If we reached a terminal state then exit
-		if infoResult.Status == "Accepted" || infoResult.Status == "Invalid" {
+		if terminal(infoResult.Status) {
 			break
 		}
 
 	RETRYINFO:
 		// Sleep, we just do a constant poll every 5 seconds. I haven't yet
 		// found any rate limits to the service so this seems okay.
-		time.Sleep(5 * time.Second)
+		if err := sleep(ctx, 5*time.Second); err != nil {
+			return infoResult, nil, err
+		}
 	}
 
 	logResult := &Log{JobId: uuid}
@@ -207,10 +373,15 @@ func Notarize(ctx context.Context, opts *Options) (*Info, *Log, error) {
 		}
 
 		if err != nil {
-			// This code is the network became unavailable error. If this
-			// happens then we just log and retry.
-			if e, ok := err.(Errors); ok && e.ContainsCode(-19000) {
-				logger.Warn("error that network became unavailable, will retry")
+			// If the network became unavailable or we're rate limited we
+			// just log and retry. Rate limiting waits for another interval.
+			if retryable(err) {
+				logger.Warn("error requesting notarization log, will retry", "err", err)
+				if errors.Is(err, ErrRateLimited) {
+					if err := sleep(ctx, pollInterval); err != nil {
+						return infoResult, logResult, err
+					}
+				}
 				goto RETRYLOG
 			}
 
@@ -220,51 +391,74 @@ func Notarize(ctx context.Context, opts *Options) (*Info, *Log, error) {
 		status.LogStatus(*logResult)
 
 		// If we reached a terminal state then exit
-		if logResult.Status == "Accepted" || logResult.Status == "Invalid" {
+		if terminal(logResult.Status) {
 			break
 		}
 
 	RETRYLOG:
 		// Sleep, we just do a constant poll every 5 seconds. I haven't yet
 		// found any rate limits to the service so this seems okay.
-		time.Sleep(pollInterval)
+		if err := sleep(ctx, pollInterval); err != nil {
+			return infoResult, logResult, err
+		}
 	}
 
 	// If we're in an invalid status then return an error
-	err = nil
-	if logResult.Status == "Invalid" && infoResult.Status == "Invalid" {
-		err = fmt.Errorf("package is invalid.")
+	if failed(logResult.Status) && failed(infoResult.Status) {
+		return infoResult, logResult, &InvalidError{Info: infoResult, Log: logResult}
 	}
 
-	return infoResult, logResult, err
+	return infoResult, logResult, nil
 }
 
-func guessApiKeyFile(apiKey string) (string, error) {
-	usr, err := user.Current()
-	if err != nil {
-		return "", fmt.Errorf("can't resolve homedir: %w", err)
-	}
+// terminal returns true if a submission with the status is done, whether
+// it was accepted or not.
+func terminal(status string) bool {
+	return status == "Accepted" || failed(status)
+}
 
-	// `xcrun altool --help` -- apiKey param comment.
-	altoolDefaultDirs := []string{
-		"./private_keys",
-		"~/private_keys",
-		"~/.private_keys",
-		"~/.appstoreconnect/private_keys",
-	}
-	if envDir := os.Getenv("API_PRIVATE_KEYS_DIR"); envDir != "" {
-		altoolDefaultDirs = []string{envDir}
-	}
+// failed returns true if a submission with the status failed notarization.
+// The Notary API reports "Rejected" as well as "Invalid".
+func failed(status string) bool {
+	return status == "Invalid" || status == "Rejected"
+}
 
-	keyName := "AuthKey_" + apiKey + ".p8"
-	for _, dir := range altoolDefaultDirs {
-		if strings.HasPrefix(dir, "~/") {
-			dir = filepath.Join(usr.HomeDir, dir[2:])
-		}
-		path := filepath.Join(dir, keyName)
-		if s, err := os.Stat(path); err == nil && s.Mode().IsRegular() {
-			return path, nil
-		}
+// retryable returns true if a request that failed with err may succeed if
+// it's retried later.
+func retryable(err error) bool {
+	return errors.Is(err, ErrNetwork) || errors.Is(err, ErrRateLimited)
+}
+
+// sleep waits for the duration, returning early with ctx.Err() if ctx is
+// done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return "", fmt.Errorf("can't found an API key file in default dirs")
+}
+
+// lockedBuffer is a buffer that can be written to concurrently. It is used
+// for the combined output of commands, which is written to both from the
+// copies of stdout and stderr.
+type lockedBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
 }
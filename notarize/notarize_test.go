@@ -1,12 +1,16 @@
 package notarize
 
 import (
+	"context"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMain(m *testing.M) {
@@ -49,3 +53,75 @@ func childCmd(t *testing.T, name string, args ...string) *exec.Cmd {
 
 	return cmd
 }
+
+func init() {
+	childCommands["notarytool-invalid"] = testCmdNotarytoolInvalid
+}
+
+func TestNotarize_canceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// Waiting for an existing request doesn't outlive the context
+	interval := time.Hour
+	info, _, err := Notarize(ctx, &Options{
+		DeveloperId:     "foo@example.com",
+		Password:        "bar",
+		Logger:          hclog.L(),
+		RequestUUID:     "cfd69166-8e2f-1397-8636-ec06f98e3597",
+		PollingInterval: &interval,
+	})
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.Equal(t, "cfd69166-8e2f-1397-8636-ec06f98e3597", info.RequestUUID)
+}
+
+func TestNotarize_invalid(t *testing.T) {
+	interval := time.Millisecond
+	_, _, err := Notarize(context.Background(), &Options{
+		DeveloperId:     "foo@example.com",
+		Password:        "bar",
+		Logger:          hclog.L(),
+		BaseCmd:         childCmd(t, "notarytool-invalid"),
+		RequestUUID:     "4ba7c420-7444-44bc-a190-1bd4bad97b13",
+		PollingInterval: &interval,
+	})
+
+	// The rejection carries the log with the issues
+	require := require.New(t)
+	require.True(errors.Is(err, ErrInvalidPackage))
+	var invalid *InvalidError
+	require.True(errors.As(err, &invalid))
+	require.Equal("Invalid", invalid.Info.Status)
+	require.Len(invalid.Log.Issues, 3)
+	require.Contains(string(invalid.Log.Raw), `"logFormatVersion": 1`)
+	require.Equal("package is invalid: Archive contains critical validation errors", err.Error())
+}
+
+// testCmdNotarytoolInvalid mimicks notarytool for a rejected request.
+func testCmdNotarytoolInvalid() int {
+	if os.Args[2] == "log" {
+		return testCmdLogInvalidSubmission()
+	}
+
+	return testCmdInfoInvalidSubmission()
+}
+
+func TestOptions_AuthArgs_passwordReference(t *testing.T) {
+	os.Setenv("GON_TEST_PASSWORD", "hunter2")
+	defer os.Unsetenv("GON_TEST_PASSWORD")
+
+	// The reference is resolved rather than passed to notarytool
+	args, err := Options{
+		DeveloperId: "foo@example.com",
+		Password:    "@env:GON_TEST_PASSWORD",
+	}.AuthArgs()
+	require.NoError(t, err)
+	require.Equal(t, []string{"--apple-id", "foo@example.com", "--password", "hunter2"}, args)
+
+	_, err = Options{
+		DeveloperId: "foo@example.com",
+		Password:    "@env:GON_TEST_MISSING",
+	}.AuthArgs()
+	require.EqualError(t, err,
+		"error resolving @env:GON_TEST_MISSING: environment variable GON_TEST_MISSING isn't set")
+}
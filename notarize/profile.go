@@ -0,0 +1,269 @@
+package notarize
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/bi-zone/gon/apikey"
+	"github.com/bi-zone/gon/internal/execctx"
+	"github.com/bi-zone/gon/internal/securitycmd"
+	"github.com/bi-zone/gon/secret"
+)
+
+// profile is a notarytool keychain profile holding Apple ID credentials in
+// a temporary keychain, see Options.TemporaryProfile. It is created the
+// first time it's needed, so nothing is run while waiting on an existing
+// request, and removed by Notarize when it returns.
+type profile struct {
+	lock     sync.Mutex
+	dir      string
+	keychain string
+	name     string
+}
+
+// args returns the notarytool arguments to authenticate with the profile,
+// creating it first if needed.
+func (p *profile) args(ctx context.Context, opts *Options) ([]string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.name == "" {
+		if err := p.create(ctx, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return []string{
+		"--keychain-profile", p.name,
+		"--keychain", p.keychain,
+	}, nil
+}
+
+// create creates the keychain, unless an earlier attempt did, and stores
+// the credentials in it. The password is on the command line of
+// `notarytool store-credentials` only.
+func (p *profile) create(ctx context.Context, opts *Options) error {
+	resolved, err := opts.resolvePassword(ctx)
+	if err != nil {
+		return err
+	}
+
+	if p.keychain == "" {
+		dir, err := ioutil.TempDir("", "gon")
+		if err != nil {
+			return err
+		}
+
+		// The keychain password is random and only good for this keychain,
+		// which is deleted afterwards.
+		password, err := randomHex(16)
+		if err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+
+		keychain := filepath.Join(dir, "notarytool.keychain-db")
+		if err := security(ctx, opts, "create-keychain", "-p", password, keychain); err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+
+		// The password isn't kept, so don't let the keychain lock itself
+		// while waiting for notarization, however long it takes
+		if err := security(ctx, opts, "set-keychain-settings", keychain); err != nil {
+			security(context.Background(), opts, "delete-keychain", keychain)
+			os.RemoveAll(dir)
+			return err
+		}
+		p.dir, p.keychain = dir, keychain
+	}
+
+	suffix, err := randomHex(4)
+	if err != nil {
+		return err
+	}
+	name := "gon-" + suffix
+
+	if err := storeCredentials(ctx, name, p.keychain, resolved); err != nil {
+		return err
+	}
+
+	p.name = name
+	return nil
+}
+
+// StoreCredentials stores the Apple ID and password or the API key of opts
+// in the notarytool keychain profile named by opts.KeychainProfile, like
+// `notarytool store-credentials`. Later runs can then authenticate with
+// the profile alone, keeping the secrets out of their configuration.
+// notarytool validates the credentials with Apple before storing them.
+func StoreCredentials(ctx context.Context, opts *Options) error {
+	if opts.KeychainProfile == "" {
+		return errors.New("no keychain profile name given")
+	}
+
+	// The profile is what's being created, so authenticate without it
+	creds := *opts
+	creds.KeychainProfile = ""
+	resolved, err := creds.resolvePassword(ctx)
+	if err != nil {
+		return err
+	}
+
+	resolved, removeKey, err := resolved.withKeyFile()
+	if err != nil {
+		return err
+	}
+	defer removeKey()
+
+	return storeCredentials(ctx, opts.KeychainProfile, "", resolved)
+}
+
+// storeCredentials stores the credentials of opts in the keychain profile
+// with the given name, in the given keychain or the login keychain if it's
+// empty. The password of opts must be resolved.
+func storeCredentials(ctx context.Context, name, keychain string, opts *Options) error {
+	logger := opts.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	var creds []string
+	switch {
+	case opts.ApiKey != "" && opts.ApiIssuer != "":
+		path := opts.ApiKeyPath
+		if path == "" {
+			var err error
+			path, err = apikey.Find(opts.ApiKey)
+			if err != nil {
+				return fmt.Errorf("%w. %s",
+					err, "Please specify api_key_path or put a key into default altool location")
+			}
+		}
+		creds = []string{
+			"--key-id", opts.ApiKey,
+			"--issuer", opts.ApiIssuer,
+			"--key", path,
+		}
+	case opts.DeveloperId != "" && opts.Password != "":
+		creds = []string{
+			"--apple-id", opts.DeveloperId,
+			"--password", opts.Password,
+		}
+		if opts.Provider != "" {
+			creds = append(creds, "--team-id", opts.Provider)
+		}
+	default:
+		return fmt.Errorf("no credentials to store given. " +
+			"Please specify Apple username + password or api_key + api_issuer")
+	}
+
+	// Build our command
+	var cmd exec.Cmd
+	if opts.BaseCmd != nil {
+		cmd = *opts.BaseCmd
+	}
+
+	// We only set the path if it isn't set. This lets the options set the
+	// path to the notarytool binary that we use.
+	if cmd.Path == "" {
+		path, err := exec.LookPath("xcrun")
+		if err != nil {
+			return err
+		}
+		cmd.Path = path
+	}
+
+	cmd.Args = []string{
+		filepath.Base(cmd.Path),
+		"notarytool",
+		"store-credentials", name,
+	}
+	cmd.Args = append(cmd.Args, creds...)
+	if keychain != "" {
+		cmd.Args = append(cmd.Args, "--keychain", keychain)
+	}
+
+	var out bytes.Buffer
+	var combined lockedBuffer
+	cmd.Stdout = io.MultiWriter(&out, &combined)
+	cmd.Stderr = &combined
+
+	// Log what we're going to execute
+	logger.Info("storing notarization credentials in a keychain profile",
+		"profile", name,
+		"keychain", keychain,
+		"command_path", cmd.Path,
+		"command_args", secret.RedactArgs(cmd.Args),
+	)
+
+	err := execctx.Run(ctx, &cmd, opts.CommandTimeout)
+	if execctx.Stopped(err) {
+		return err
+	}
+	if err != nil {
+		logger.Error("error storing notarization credentials", "err", err, "output", secret.Redact(combined.String()))
+		return newToolError("store-credentials", out.String(), combined.String())
+	}
+
+	return nil
+}
+
+// remove deletes the keychain, if it was created. It runs even if the
+// context of Notarize is done, so only the command timeout applies.
+func (p *profile) remove(opts *Options) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.keychain == "" {
+		return
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	if err := security(context.Background(), opts, "delete-keychain", p.keychain); err != nil {
+		logger.Warn("error deleting temporary keychain", "keychain", p.keychain, "err", err)
+	}
+	if err := os.RemoveAll(p.dir); err != nil {
+		logger.Warn("error removing temporary keychain directory", "path", p.dir, "err", err)
+	}
+
+	p.dir, p.keychain, p.name = "", "", ""
+}
+
+// security runs the security binary with the given arguments.
+func security(ctx context.Context, opts *Options, args ...string) error {
+	_, err := securitycmd.Run(ctx, &securitycmd.Options{
+		Logger:     opts.Logger,
+		Timeout:    opts.CommandTimeout,
+		BaseCmd:    opts.SecurityCmd,
+		Redact:     secret.Redact,
+		RedactArgs: secret.RedactArgs,
+	}, args...)
+	return err
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,156 @@
+package notarize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	childCommands["notarytool-profile"] = testCmdNotarytoolProfile
+	childCommands["security-keychain"] = testCmdSecurityKeychain
+	childCommands["store-credentials"] = testCmdStoreCredentials
+}
+
+func TestOptions_AuthArgs_keychainProfile(t *testing.T) {
+	// The profile takes precedence and the password isn't resolved
+	args, err := Options{
+		DeveloperId:     "foo@example.com",
+		Password:        "@env:GON_TEST_MISSING",
+		ApiKey:          "ABCDEFGHIJ",
+		ApiIssuer:       "c055ca8c-e5a8-4836-b61d-aa5794eeb3f4",
+		KeychainProfile: "gon",
+	}.AuthArgs()
+	require.NoError(t, err)
+	require.Equal(t, []string{"--keychain-profile", "gon"}, args)
+}
+
+func TestStoreCredentials(t *testing.T) {
+	err := StoreCredentials(context.Background(), &Options{
+		DeveloperId:     "foo@example.com",
+		Password:        "hunter2",
+		Provider:        "TEAMID",
+		KeychainProfile: "gon",
+		Logger:          hclog.L(),
+		BaseCmd:         childCmd(t, "store-credentials"),
+	})
+	require.NoError(t, err)
+
+	err = StoreCredentials(context.Background(), &Options{
+		DeveloperId: "foo@example.com",
+		Password:    "hunter2",
+	})
+	require.EqualError(t, err, "no keychain profile name given")
+}
+
+func TestNotarize_temporaryProfile(t *testing.T) {
+	interval := time.Millisecond
+	info, log, err := Notarize(context.Background(), &Options{
+		File:             "binary.zip",
+		DeveloperId:      "foo@example.com",
+		Password:         "hunter2",
+		Logger:           hclog.L(),
+		BaseCmd:          childCmd(t, "notarytool-profile"),
+		SecurityCmd:      childCmd(t, "security-keychain"),
+		PollingInterval:  &interval,
+		TemporaryProfile: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Accepted", info.Status)
+	require.Equal(t, "Accepted", log.Status)
+}
+
+func TestNotarize_temporaryProfileError(t *testing.T) {
+	// Creating the profile fails like any other notarytool command
+	interval := time.Millisecond
+	_, _, err := Notarize(context.Background(), &Options{
+		File:             "binary.zip",
+		DeveloperId:      "foo@example.com",
+		Password:         "hunter2",
+		Logger:           hclog.L(),
+		BaseCmd:          childCmd(t, "info-auth"),
+		SecurityCmd:      childCmd(t, "security-keychain"),
+		PollingInterval:  &interval,
+		TemporaryProfile: true,
+	})
+	require.Error(t, err)
+
+	var terr *ToolError
+	require.True(t, errors.As(err, &terr))
+	require.Equal(t, "store-credentials", terr.Command)
+	require.True(t, errors.Is(err, ErrAuth))
+}
+
+// testCmdNotarytoolProfile mimicks notarytool, checking that only
+// store-credentials gets the password.
+func testCmdNotarytoolProfile() int {
+	command := os.Args[2]
+	hasPassword, hasProfile := false, false
+	for i, arg := range os.Args {
+		switch arg {
+		case "--password":
+			hasPassword = os.Args[i+1] == "hunter2"
+		case "--keychain-profile":
+			hasProfile = true
+		}
+	}
+
+	if command == "store-credentials" {
+		if !hasPassword {
+			fmt.Fprintf(os.Stderr, "no password: %q\n", os.Args)
+			return 1
+		}
+		return 0
+	}
+	if hasPassword || !hasProfile {
+		fmt.Fprintf(os.Stderr, "expected a profile rather than the password: %q\n", os.Args)
+		return 1
+	}
+
+	switch command {
+	case "submit":
+		return testCmdUploadSuccess()
+	case "log":
+		return testCmdLogValidSubmission()
+	}
+	return testCmdInfoAcceptedSubmission()
+}
+
+// testCmdSecurityKeychain mimicks security creating and deleting a
+// keychain that never locks.
+func testCmdSecurityKeychain() int {
+	switch os.Args[1] {
+	case "create-keychain", "delete-keychain":
+		return 0
+	case "set-keychain-settings":
+		// Without -l or -t, which would lock it on sleep or timeout
+		if len(os.Args) == 3 {
+			return 0
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unexpected arguments: %q\n", os.Args)
+	return 1
+}
+
+// testCmdStoreCredentials mimicks notarytool storing an Apple ID profile.
+func testCmdStoreCredentials() int {
+	expected := []string{
+		"notarytool", "store-credentials", "gon",
+		"--apple-id", "foo@example.com",
+		"--password", "hunter2",
+		"--team-id", "TEAMID",
+	}
+	if fmt.Sprint(os.Args[1:]) != fmt.Sprint(expected) {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %q\n", os.Args)
+		return 1
+	}
+
+	return 0
+}
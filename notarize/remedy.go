@@ -0,0 +1,81 @@
+package notarize
+
+import (
+	"strings"
+)
+
+// remedyRules turn the issues of a notarization log into fixes, see
+// LogIssue.Remedy. The first rule whose message and path patterns both
+// match is used. Patterns are matched case-insensitively as substrings,
+// and an empty list matches anything.
+var remedyRules = []struct {
+	messages []string
+	paths    []string
+	remedy   string
+}{
+	{
+		messages: []string{"get-task-allow"},
+		remedy: "The com.apple.security.get-task-allow entitlement is only for debug builds. " +
+			"Remove it from the sign block's entitlements_file, or build in release mode.",
+	},
+	{
+		messages: []string{"hardened runtime"},
+		remedy: "Sign the file with the sign block, which enables the hardened runtime, " +
+			"by listing it in source. Files signed before gon runs must be signed again.",
+	},
+	{
+		messages: []string{"secure timestamp"},
+		remedy: "Sign the file with the sign block, which requests a secure timestamp, " +
+			"by listing it in source. codesign needs to reach Apple's timestamp server for this.",
+	},
+	{
+		messages: []string{"developer id certificate", "valid developer id", "not signed with a valid"},
+		remedy: "Set the sign block's application_identity to a \"Developer ID Application\" " +
+			"certificate. Development and distribution certificates can't be notarized.",
+	},
+	{
+		messages: []string{"not signed", "signature of the binary is invalid"},
+		paths:    []string{".framework/", ".dylib", ".bundle/", ".xpc/", ".plugin/", ".appex/", ".app/contents/"},
+		remedy: "Code nested in a bundle must be signed before the bundle itself. " +
+			"Set deep = true in the sign block to sign the code nested in the bundles in source first, inside out.",
+	},
+	{
+		messages: []string{"not signed", "signature of the binary is invalid"},
+		remedy: "List the file in source so the sign block signs it " +
+			"before it's packaged. Every executable in a package must be signed.",
+	},
+	{
+		messages: []string{"sdk older than", "sdk version", "minimum supported sdk"},
+		remedy: "Build the binary with the macOS 10.9 SDK or later. For Go binaries, " +
+			"use a Go release that supports the macOS versions you target.",
+	},
+}
+
+// Remedy returns how to fix the issue, empty if there is no known fix.
+func (i LogIssue) Remedy() string {
+	message := strings.ToLower(i.Message)
+	path := strings.ToLower(i.Path)
+	for _, r := range remedyRules {
+		if containsAny(message, r.messages) && containsAny(path, r.paths) {
+			return r.remedy
+		}
+	}
+
+	return ""
+}
+
+// containsAny returns true if s contains any of the patterns, or if there
+// are no patterns.
+func containsAny(s string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, p := range patterns {
+		if strings.Contains(s, p) {
+			return true
+		}
+	}
+
+	return false
+}
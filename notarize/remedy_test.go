@@ -0,0 +1,69 @@
+package notarize
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogIssue_Remedy(t *testing.T) {
+	cases := []struct {
+		Path    string
+		Message string
+		Remedy  string
+	}{
+		{
+			"gon.zip/foo",
+			"The executable does not have the hardened runtime enabled.",
+			"enables the hardened runtime",
+		},
+		{
+			"gon.zip/foo",
+			"The signature does not include a secure timestamp.",
+			"requests a secure timestamp",
+		},
+		{
+			"gon.zip/foo",
+			"The binary is not signed.",
+			"List the file in source",
+		},
+		{
+			"app.zip/App.app/Contents/Frameworks/Lib.framework/Versions/A/Lib",
+			"The binary is not signed.",
+			"deep = true",
+		},
+		{
+			"gon.zip/foo",
+			"The executable requests the com.apple.security.get-task-allow entitlement.",
+			"entitlements_file",
+		},
+		{
+			"gon.zip/foo",
+			"The binary uses an SDK older than the 10.9 SDK.",
+			"10.9 SDK or later",
+		},
+		{
+			"gon.zip/foo",
+			"The binary is not signed with a valid Developer ID certificate.",
+			"application_identity",
+		},
+		{
+			"gon.zip/foo",
+			"Something nobody has seen before.",
+			"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Message, func(t *testing.T) {
+			remedy := LogIssue{Severity: "error", Path: tc.Path, Message: tc.Message}.Remedy()
+			if tc.Remedy == "" {
+				require.Empty(t, remedy)
+				return
+			}
+
+			require.True(t, strings.Contains(remedy, tc.Remedy), remedy)
+		})
+	}
+}
@@ -9,6 +9,9 @@ import (
 	"path/filepath"
 
 	"github.com/hashicorp/go-hclog"
+
+	"github.com/bi-zone/gon/internal/execctx"
+	"github.com/bi-zone/gon/secret"
 	"howett.net/plist"
 )
 
@@ -20,6 +23,11 @@ func upload(ctx context.Context, opts *Options) (string, error) {
 		logger = hclog.NewNullLogger()
 	}
 
+	// If we're talking to the Notary API directly, there is no command to run
+	if opts.API != nil {
+		return opts.API.upload(ctx, opts)
+	}
+
 	// Build our command
 	var cmd exec.Cmd
 	if opts.BaseCmd != nil {
@@ -46,14 +54,15 @@ func upload(ctx context.Context, opts *Options) (string, error) {
 		cmd.Args = append(cmd.Args, "--team-id", opts.Provider)
 	}
 
-	auth, err := opts.AuthArgs()
+	auth, err := opts.authArgs(ctx)
 	if err != nil {
 		return "", err
 	}
 	cmd.Args = append(cmd.Args, auth...)
 
 	// We store all output in out for logging and in case there is an error
-	var out, combined bytes.Buffer
+	var out bytes.Buffer
+	var combined lockedBuffer
 	cmd.Stdout = io.MultiWriter(&out, &combined)
 	cmd.Stderr = &combined
 
@@ -61,20 +70,29 @@ func upload(ctx context.Context, opts *Options) (string, error) {
 	logger.Info("submitting file for notarization",
 		"file", opts.File,
 		"command_path", cmd.Path,
-		"command_args", cmd.Args,
+		"command_args", secret.RedactArgs(cmd.Args),
 	)
 
 	// Execute
-	err = cmd.Run()
+	err = execctx.Run(ctx, &cmd, opts.CommandTimeout)
 
 	// Log the result
 	logger.Info("notarization submission complete",
-		"output", out.String(),
+		"output", secret.Redact(out.String()),
 		"err", err,
 	)
 
-	// If we have any output, try to decode that since even in the case of
-	// an error it will output some information.
+	// If the command was stopped the output is incomplete
+	if execctx.Stopped(err) {
+		return "", err
+	}
+
+	// notarytool reports failures in its output, so it is only decoded
+	// as a result if the command succeeded.
+	if err != nil {
+		return "", newToolError("submit", out.String(), combined.String())
+	}
+
 	var result uploadResult
 	if out.Len() > 0 {
 		if _, perr := plist.Unmarshal(out.Bytes(), &result); perr != nil {
@@ -82,11 +100,6 @@ func upload(ctx context.Context, opts *Options) (string, error) {
 		}
 	}
 
-	// Now we check the error for actually running the process
-	if err != nil {
-		return "", fmt.Errorf("error submitting for notarization:\n\n%s", combined.String())
-	}
-
 	// We should have a request UUID set at this point since we checked for errors
 	if result.RequestUUID == "" {
 		return "", fmt.Errorf(
@@ -17,8 +17,10 @@ func init() {
 
 func TestUpload_success(t *testing.T) {
 	uuid, err := upload(context.Background(), &Options{
-		Logger:  hclog.L(),
-		BaseCmd: childCmd(t, "upload-success"),
+		DeveloperId: "foo@example.com",
+		Password:    "bar",
+		Logger:      hclog.L(),
+		BaseCmd:     childCmd(t, "upload-success"),
 	})
 
 	require.NoError(t, err)
@@ -27,8 +29,10 @@ func TestUpload_success(t *testing.T) {
 
 func TestUpload_exitStatus(t *testing.T) {
 	uuid, err := upload(context.Background(), &Options{
-		Logger:  hclog.L(),
-		BaseCmd: childCmd(t, "upload-exit-status"),
+		DeveloperId: "foo@example.com",
+		Password:    "bar",
+		Logger:      hclog.L(),
+		BaseCmd:     childCmd(t, "upload-exit-status"),
 	})
 
 	require.Error(t, err)
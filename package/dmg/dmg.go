@@ -17,10 +17,13 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 
 	"github.com/bi-zone/gon/internal/createdmg"
+	"github.com/bi-zone/gon/internal/execctx"
+	"github.com/bi-zone/gon/secret"
 )
 
 // Options are the options for creating the dmg archive.
@@ -57,6 +60,9 @@ type Options struct {
 	// Logger is the logger to use. If this is nil then no logging will be done.
 	Logger hclog.Logger
 
+	// Timeout, if positive, limits how long the create-dmg command may run.
+	Timeout time.Duration
+
 	// BaseCmd is the base command for executing the codesign binary. This is
 	// used for tests to overwrite where the codesign binary is.
 	BaseCmd *exec.Cmd
@@ -135,15 +141,18 @@ func Dmg(ctx context.Context, opts *Options) error {
 	logger.Info("executing create-dmg for dmg creation",
 		"output_path", opts.OutputPath,
 		"command_path", cmd.Path,
-		"command_args", cmd.Args,
+		"command_args", secret.RedactArgs(cmd.Args),
 	)
 
 	// Execute
-	if err := cmd.Run(); err != nil {
-		logger.Error("error creating dmg", "err", err, "output", out.String())
-		return fmt.Errorf("error creating dmg:\n\n%s", out.String())
+	if err := execctx.Run(ctx, cmd, opts.Timeout); err != nil {
+		logger.Error("error creating dmg", "err", err, "output", secret.Redact(out.String()))
+		if execctx.Stopped(err) {
+			return err
+		}
+		return fmt.Errorf("error creating dmg:\n\n%s", secret.Redact(out.String()))
 	}
 
-	logger.Info("dmg creation complete", "output", out.String())
+	logger.Info("dmg creation complete", "output", secret.Redact(out.String()))
 	return nil
 }
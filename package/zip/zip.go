@@ -8,8 +8,12 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
+
+	"github.com/bi-zone/gon/internal/execctx"
+	"github.com/bi-zone/gon/secret"
 )
 
 // Options are the options for creating the zip archive.
@@ -25,6 +29,9 @@ type Options struct {
 	// Logger is the logger to use. If this is nil then no logging will be done.
 	Logger hclog.Logger
 
+	// Timeout, if positive, limits how long each ditto command may run.
+	Timeout time.Duration
+
 	// BaseCmd is the base command for executing the codesign binary. This is
 	// used for tests to overwrite where the codesign binary is.
 	BaseCmd *exec.Cmd
@@ -72,16 +79,16 @@ func Zip(ctx context.Context, opts *Options) error {
 	logger.Info("executing ditto for zip archive creation",
 		"output_path", opts.OutputPath,
 		"command_path", cmd.Path,
-		"command_args", cmd.Args,
+		"command_args", secret.RedactArgs(cmd.Args),
 	)
 
 	// Execute
-	if err = cmd.Run(); err != nil {
-		logger.Error("error creating zip archive", "err", err, "output", out.String())
+	if err = execctx.Run(ctx, cmd, opts.Timeout); err != nil {
+		logger.Error("error creating zip archive", "err", err, "output", secret.Redact(out.String()))
 		return err
 	}
 
-	logger.Info("zip archive creation complete", "output", out.String())
+	logger.Info("zip archive creation complete", "output", secret.Redact(out.String()))
 	return nil
 }
 
@@ -148,17 +155,17 @@ func createRoot(ctx context.Context, logger hclog.Logger, opts *Options) (string
 	logger.Info("executing ditto to copy files for archiving",
 		"output_path", opts.OutputPath,
 		"command_path", cmd.Path,
-		"command_args", cmd.Args,
+		"command_args", secret.RedactArgs(cmd.Args),
 	)
 
 	// Execute copy
-	if err = cmd.Run(); err != nil {
+	if err = execctx.Run(ctx, cmd, opts.Timeout); err != nil {
 		os.RemoveAll(root)
 
 		logger.Error(
 			"error copying source files to create zip archive",
 			"err", err,
-			"output", out.String(),
+			"output", secret.Redact(out.String()),
 		)
 		return "", err
 	}
@@ -0,0 +1,127 @@
+package pipeline
+
+import (
+	"github.com/bi-zone/gon/notarize"
+)
+
+// Stage is a step of the pipeline.
+type Stage string
+
+const (
+	StageSign     Stage = "sign"
+	StageZip      Stage = "zip"
+	StageDmg      Stage = "dmg"
+	StageSignDmg  Stage = "sign-dmg"
+	StageNotarize Stage = "notarize"
+	StageStaple   Stage = "staple"
+
+	// StageKeychain creates the temporary keychain of the configuration
+	// before anything is signed. It isn't recorded in the state and runs
+	// along with StageSign and StageDmg.
+	StageKeychain Stage = "keychain"
+)
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+const (
+	// EventTarget is sent when processing of a named target starts.
+	EventTarget EventKind = iota
+
+	// EventStarted and EventFinished are sent when a stage starts and
+	// finishes successfully. EventFailed is sent instead of EventFinished
+	// if the stage failed, with Err set.
+	//
+	// For StageNotarize, EventStarted and EventFinished without an Item
+	// are sent around the notarization of all items, with Items set on
+	// EventStarted. The per-item notarization and stapling events have
+	// Item set.
+	EventStarted
+	EventFinished
+	EventFailed
+
+	// EventSkipped is sent instead of EventStarted if the stage already
+	// finished in an earlier run, see Options.Resume.
+	EventSkipped
+
+	// EventSubmitted is sent when an item was submitted for notarization,
+	// with RequestUUID set.
+	EventSubmitted
+
+	// EventInfoStatus and EventLogStatus are sent as the notarization
+	// status of an item is polled, with Info or Log set.
+	EventInfoStatus
+	EventLogStatus
+
+	// EventWarning is sent while a stage runs for a problem that doesn't
+	// fail it, such as a signing certificate that expires soon, with
+	// Warning set.
+	EventWarning
+)
+
+// Event is a progress event of the pipeline, see Options.Events.
+type Event struct {
+	Kind  EventKind
+	Stage Stage
+
+	// Target is the name of the target being processed, empty for the
+	// top-level target.
+	Target string
+
+	// Path is the file the stage works on: the archive for StageZip,
+	// StageDmg and StageSignDmg. It's empty for StageSign, which signs
+	// all the source files.
+	Path string
+
+	// Item is the item for per-item notarization and stapling events.
+	// Items are all the items to notarize, set when notarization starts.
+	Item  *Item
+	Items []*Item
+
+	RequestUUID string
+	Info        *notarize.Info
+	Log         *notarize.Log
+
+	// Err is the error for EventFailed.
+	Err error
+
+	// Warning is the message of EventWarning.
+	Warning string
+}
+
+// itemStatus implements notarize.Status and forwards the updates as
+// events of an item.
+type itemStatus struct {
+	item   *Item
+	runner *runner
+}
+
+func (s *itemStatus) emit(e Event) {
+	s.runner.emit(e)
+}
+
+func (s *itemStatus) Submitting() {
+	s.emit(Event{Kind: EventStarted, Stage: StageNotarize, Target: s.item.Target, Item: s.item})
+}
+
+func (s *itemStatus) Submitted(uuid string) {
+	s.item.RequestUUID = uuid
+	if err := s.runner.state.submitted(s.item.Target, s.item.Path, uuid); err != nil {
+		s.runner.logger.Warn("error saving state file", "path", s.item.Path, "err", err)
+	}
+
+	s.emit(Event{Kind: EventSubmitted, Stage: StageNotarize, Target: s.item.Target, Item: s.item,
+		RequestUUID: uuid})
+}
+
+func (s *itemStatus) InfoStatus(info notarize.Info) {
+	s.emit(Event{Kind: EventInfoStatus, Stage: StageNotarize, Target: s.item.Target, Item: s.item,
+		Info: &info})
+}
+
+func (s *itemStatus) LogStatus(log notarize.Log) {
+	s.emit(Event{Kind: EventLogStatus, Stage: StageNotarize, Target: s.item.Target, Item: s.item,
+		Log: &log})
+}
+
+var _ notarize.Status = (*itemStatus)(nil)
@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/bi-zone/gon/config"
+	"github.com/bi-zone/gon/internal/execctx"
+	"github.com/bi-zone/gon/sign"
+)
+
+// identity returns the identity to sign the files of the target with: the
+// configured application identity, or else the single "Developer ID
+// Application" identity in the keychain. Only the keychain of the sign
+// block or else the temporary keychain is searched, if there is one.
+//
+// The certificate of the identity is checked before anything is signed,
+// see sign.CheckCertificate, and its warnings are sent as EventWarning of
+// the stage.
+//
+// If the items are to be notarized with an Apple ID and no provider is
+// set, the team ID of the certificate becomes the provider of creds.
+func (r *runner) identity(ctx context.Context, t *config.Target, stage Stage, creds *config.AppleId, logger hclog.Logger) (string, error) {
+	value := t.Sign.ApplicationIdentity
+	opts := &sign.IdentityOptions{
+		Keychain: r.signKeychain(t),
+		Logger:   logger.Named("identity"),
+		Timeout:  r.commandTimeout,
+	}
+
+	id, err := sign.FindIdentity(ctx, value, opts)
+	if err != nil {
+		if value == "" {
+			return "", err
+		}
+
+		// codesign may find it all the same, it just isn't checked
+		logger.Warn("error finding the signing identity, its certificate isn't checked",
+			"identity", value, "err", err)
+		return value, nil
+	}
+	if value == "" {
+		logger.Info("signing with the identity found in the keychain", "identity", id.Name, "hash", id.Hash)
+		value = id.Hash
+	}
+
+	cert, err := sign.Certificate(ctx, id, opts)
+	if err != nil {
+		return "", err
+	}
+	if err := r.checkCertificate(ctx, t, stage, cert, opts); err != nil {
+		return "", err
+	}
+
+	if r.opts.notarize() && creds.Provider == "" &&
+		creds.Username != "" && creds.ApiKey == "" && creds.KeychainProfile == "" {
+		if teamID := sign.TeamID(cert); teamID != "" {
+			logger.Info("notarizing with the team ID of the signing identity", "team_id", teamID)
+			creds.Provider = teamID
+		}
+	}
+
+	return value, nil
+}
+
+// checkCertificate checks the certificate of the signing identity with the
+// expiry settings of the target.
+func (r *runner) checkCertificate(ctx context.Context, t *config.Target, stage Stage, cert *x509.Certificate, opts *sign.IdentityOptions) error {
+	warning, fail, err := t.Sign.Expiry()
+	if err != nil {
+		return err
+	}
+
+	// Without the Apple certificates the chain isn't checked, which
+	// doesn't keep the identity from signing.
+	var warnings []string
+	roots, intermediates, err := sign.AppleCertificates(ctx, opts)
+	if err != nil {
+		if execctx.Stopped(err) {
+			return err
+		}
+		warnings = append(warnings, fmt.Sprintf("the certificate chain isn't checked: %s", err))
+		roots, intermediates = nil, nil
+	}
+
+	checked, err := sign.CheckCertificate(cert, &sign.CheckOptions{
+		ExpiryWarning: warning,
+		ExpiryError:   fail,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		return err
+	}
+	warnings = append(warnings, checked...)
+
+	for _, w := range warnings {
+		opts.Logger.Warn(w)
+		r.emit(Event{Kind: EventWarning, Stage: stage, Target: t.Name, Warning: w})
+	}
+
+	return nil
+}
+
+// signKeychain returns the keychain to sign the files of the target with:
+// the one of the sign block or else the temporary keychain. It's empty if
+// there is neither, for the keychain search list.
+func (r *runner) signKeychain(t *config.Target) string {
+	if t.Sign.Keychain != "" {
+		return t.Sign.Keychain
+	}
+	if r.keychain != nil {
+		return r.keychain.Path
+	}
+
+	return ""
+}
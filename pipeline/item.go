@@ -0,0 +1,185 @@
+package pipeline
+
+import (
+	"context"
+	"io/ioutil"
+
+	"github.com/bi-zone/gon/config"
+	"github.com/bi-zone/gon/notarize"
+	"github.com/bi-zone/gon/staple"
+)
+
+// Item is a file to notarize and the result of notarizing it.
+type Item struct {
+	// Path is the path to the file to notarize.
+	Path string
+
+	// BundleId is the bundle ID to use for this notarization.
+	BundleId string
+
+	// Staple is true if we should perform stapling on this file. Not
+	// all files support stapling so the default depends on the type of file.
+	Staple bool
+
+	// Target is the name of the target the item belongs to, empty for
+	// the top-level target.
+	Target string
+
+	// AppleId are the credentials to notarize this item with, with the
+	// environment defaults applied.
+	AppleId *config.AppleId
+
+	// RequestUUID is the notarization request UUID once submitted.
+	RequestUUID string
+
+	// Info and Log are the last notarization info and log, if any. They
+	// may be set even if notarization failed.
+	Info *notarize.Info
+	Log  *notarize.Log
+
+	// LogPath is the path the notarization log was saved to, if
+	// Options.SaveLogs is set and the log was retrieved.
+	LogPath string
+
+	Notarized     bool
+	NotarizeError error
+
+	Stapled     bool
+	StapleError error
+}
+
+// String implements Stringer
+func (i *Item) String() string {
+	result := i.Path
+	switch {
+	case i.Notarized && i.Stapled:
+		result += " (notarized and stapled)"
+
+	case i.Notarized:
+		result += " (notarized)"
+	}
+
+	return result
+}
+
+// notarize notarizes & staples the item.
+func (i *Item) notarize(ctx context.Context, r *runner) error {
+	// Pick up where an earlier run stopped
+	if a, ok := r.state.lookup(i.Target, i.Path); ok {
+		i.RequestUUID = a.RequestUUID
+		if stageOrder[a.Stage] >= stageOrder[StageNotarize] {
+			i.Notarized = true
+			i.Stapled = a.Stage == StageStaple
+			r.emit(Event{Kind: EventSkipped, Stage: StageNotarize, Target: i.Target, Item: i})
+			return i.staple(ctx, r)
+		}
+	}
+
+	var api *notarize.API
+	if r.opts.NotaryAPI {
+		api = &notarize.API{}
+	}
+
+	limited := ctx
+	if r.notarizeTimeout > 0 {
+		var cancel context.CancelFunc
+		limited, cancel = context.WithTimeout(ctx, r.notarizeTimeout)
+		defer cancel()
+	}
+
+	info, log, err := notarize.Notarize(limited, &notarize.Options{
+		File:             i.Path,
+		DeveloperId:      i.AppleId.Username,
+		Password:         i.AppleId.Password,
+		Provider:         i.AppleId.Provider,
+		ApiKey:           i.AppleId.ApiKey,
+		ApiIssuer:        i.AppleId.ApiIssuer,
+		ApiKeyPath:       i.AppleId.ApiKeyPath,
+		ApiKeyContent:    i.AppleId.ApiKeyContent,
+		KeychainProfile:  i.AppleId.KeychainProfile,
+		Logger:           r.logger.Named("notarize"),
+		Status:           &itemStatus{item: i, runner: r},
+		UploadLock:       &r.uploadLock,
+		PollingInterval:  r.opts.PollingInterval,
+		API:              api,
+		RequestUUID:      i.RequestUUID,
+		CommandTimeout:   r.commandTimeout,
+		TemporaryProfile: true,
+	})
+	i.Info, i.Log = info, log
+	if r.opts.SaveLogs && log != nil && log.Raw != nil {
+		i.saveLog(r)
+	}
+
+	// Save the error state
+	if err != nil {
+		err = r.timeout(ctx, limited, err, TimeoutError{
+			Stage:       StageNotarize,
+			Target:      i.Target,
+			Path:        i.Path,
+			RequestUUID: i.RequestUUID,
+		})
+	}
+	i.NotarizeError = err
+	if err != nil {
+		r.emit(Event{Kind: EventFailed, Stage: StageNotarize, Target: i.Target, Item: i, Err: err})
+		return err
+	}
+	i.Notarized = true
+	r.record(i.Target, i.Path, StageNotarize, nil)
+	r.emit(Event{Kind: EventFinished, Stage: StageNotarize, Target: i.Target, Item: i})
+
+	return i.staple(ctx, r)
+}
+
+// saveLog saves the raw notarization log next to the file. Failing to
+// save it doesn't fail the notarization, it's only logged.
+func (i *Item) saveLog(r *runner) {
+	path := i.Path + ".notarization.json"
+	if err := ioutil.WriteFile(path, i.Log.Raw, 0644); err != nil {
+		r.logger.Warn("error saving notarization log", "path", path, "err", err)
+		return
+	}
+
+	i.LogPath = path
+}
+
+// staple staples the notarized item if it should be stapled.
+func (i *Item) staple(ctx context.Context, r *runner) error {
+	// If we aren't stapling we exit now
+	if !i.Staple {
+		return nil
+	}
+	if i.Stapled {
+		r.emit(Event{Kind: EventSkipped, Stage: StageStaple, Target: i.Target, Item: i})
+		return nil
+	}
+
+	// Perform the stapling
+	r.emit(Event{Kind: EventStarted, Stage: StageStaple, Target: i.Target, Item: i})
+	err := staple.Staple(ctx, &staple.Options{
+		File:    i.Path,
+		Logger:  r.logger.Named("staple"),
+		Timeout: r.commandTimeout,
+	})
+	if err != nil {
+		err = r.timeout(ctx, nil, err, TimeoutError{
+			Stage:       StageStaple,
+			Target:      i.Target,
+			Path:        i.Path,
+			RequestUUID: i.RequestUUID,
+		})
+	}
+
+	// Save our state
+	i.Stapled = err == nil
+	i.StapleError = err
+	if err != nil {
+		r.emit(Event{Kind: EventFailed, Stage: StageStaple, Target: i.Target, Item: i, Err: err})
+		return err
+	}
+	r.record(i.Target, i.Path, StageStaple, nil)
+	r.emit(Event{Kind: EventFinished, Stage: StageStaple, Target: i.Target, Item: i})
+
+	return nil
+}
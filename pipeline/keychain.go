@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/bi-zone/gon/config"
+	"github.com/bi-zone/gon/keychain"
+)
+
+// createKeychain creates the temporary keychain of the configuration, if
+// it has one and any of the targets are to be signed.
+func (r *runner) createKeychain(ctx context.Context, targets []*config.Target) error {
+	cfg := r.opts.Config.Keychain
+	if cfg == nil || !r.signs(targets) {
+		return nil
+	}
+
+	r.emit(Event{Kind: EventStarted, Stage: StageKeychain})
+	k, err := keychain.Create(ctx, &keychain.Options{
+		P12Path:    cfg.P12Path,
+		P12Content: cfg.P12Content,
+		Password:   cfg.Password,
+		Logger:     r.logger.Named("keychain"),
+		Timeout:    r.commandTimeout,
+	})
+	if err != nil {
+		err = r.timeout(ctx, nil, err, TimeoutError{Stage: StageKeychain})
+		r.emit(Event{Kind: EventFailed, Stage: StageKeychain, Err: err})
+		return err
+	}
+
+	r.keychain = k
+	r.emit(Event{Kind: EventFinished, Stage: StageKeychain})
+	return nil
+}
+
+// deleteKeychain deletes the temporary keychain, if any. It runs even if
+// the run was canceled, so only the command timeout applies. Failing to
+// delete it doesn't fail the run, it is only logged.
+func (r *runner) deleteKeychain() {
+	if r.keychain == nil {
+		return
+	}
+
+	if err := r.keychain.Delete(context.Background()); err != nil {
+		r.logger.Warn("error deleting temporary keychain", "err", err)
+	}
+	r.keychain = nil
+}
+
+// signs returns true if any of the targets has files to be signed.
+func (r *runner) signs(targets []*config.Target) bool {
+	for _, t := range targets {
+		if len(t.Source) == 0 || t.Sign == nil {
+			continue
+		}
+		if r.opts.runs(StageSign) || (t.Dmg != nil && r.opts.runs(StageDmg)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,484 @@
+// Package pipeline runs a whole gon configuration: it signs the source
+// files, packages them into zip and dmg archives, signs the dmg, and
+// notarizes and staples the results concurrently.
+//
+// This is the same process the gon CLI runs. The lower level sign,
+// package, notarize and staple packages can be used directly for more
+// control over each step.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/bi-zone/gon/config"
+	"github.com/bi-zone/gon/keychain"
+	"github.com/bi-zone/gon/package/dmg"
+	"github.com/bi-zone/gon/package/zip"
+	"github.com/bi-zone/gon/sign"
+)
+
+// Options are the options for Run.
+type Options struct {
+	// Config is the configuration to run. This is required. It isn't
+	// modified.
+	Config *config.Config
+
+	// Targets are the names of the targets to run. All targets are run
+	// if empty.
+	Targets []string
+
+	// DontNotarize, if true, only signs and packages the files.
+	DontNotarize bool
+
+	// Stages, if non-empty, limits the stages that are run to StageSign,
+	// StageZip, StageDmg and StageNotarize. The dmg is signed as part of
+	// StageDmg and items are stapled as part of StageNotarize.
+	Stages []Stage
+
+	// StateFile, if set, is the path of a file the progress of the run is
+	// saved to as it goes, see State. It is overwritten unless Resume is set.
+	StateFile string
+
+	// Resume, if true, continues from the progress saved in StateFile by an
+	// earlier run. Stages that already finished for a file are skipped as
+	// long as the file wasn't changed since, and files that were already
+	// submitted go back to waiting for the existing notarization request.
+	Resume bool
+
+	// NotaryAPI, if true, notarizes using the Notary web API rather than
+	// executing notarytool. See notarize.API.
+	NotaryAPI bool
+
+	// PollingInterval is the notarization status polling interval. If nil
+	// the notarize package default is used.
+	PollingInterval *time.Duration
+
+	// SaveLogs, if true, saves the notarization log of each item next to
+	// the file as <file>.notarization.json, see Item.LogPath.
+	SaveLogs bool
+
+	// Timeout limits the whole run, NotarizeTimeout the notarization of
+	// each item and CommandTimeout each command that is executed. If zero,
+	// the setting of the configuration's timeouts block is used, if any.
+	// Run returns a *TimeoutError for the stage or item that was pending
+	// when a timeout expired, see IsTimeout.
+	Timeout         time.Duration
+	NotarizeTimeout time.Duration
+	CommandTimeout  time.Duration
+
+	// Events, if non-nil, is called with progress events. Calls are
+	// serialized, but come from multiple goroutines while notarizing.
+	Events func(Event)
+
+	// Logger is the logger to use. If this is nil then no logging will be done.
+	Logger hclog.Logger
+}
+
+// Result is the result of Run.
+type Result struct {
+	// Items are the files that were, or were to be, notarized, in the
+	// order of the targets. Each item has its own notarization state.
+	Items []*Item
+}
+
+// runs returns true if the stage is to be run.
+func (o *Options) runs(stage Stage) bool {
+	if len(o.Stages) == 0 {
+		return true
+	}
+
+	for _, s := range o.Stages {
+		if s == stage {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notarize returns true if the items are to be notarized.
+func (o *Options) notarize() bool {
+	return !o.DontNotarize && o.runs(StageNotarize)
+}
+
+// runner is the state of a single Run.
+type runner struct {
+	opts   *Options
+	logger hclog.Logger
+
+	// parent is the context Run was called with, before the total
+	// timeout was applied.
+	parent context.Context
+
+	total, notarizeTimeout, commandTimeout time.Duration
+
+	eventLock  sync.Mutex
+	uploadLock sync.Mutex
+
+	// state is the progress of the run, nil if it isn't saved.
+	state *stateFile
+
+	// keychain is the temporary keychain while signing, if any.
+	keychain *keychain.Keychain
+}
+
+// Run validates and runs the configuration. The configuration is validated
+// with config.Validate first and the diagnostics are returned as the error
+// if there are any errors.
+//
+// Signing and packaging stop at the first error. Notarization continues for
+// all items and the error contains every failure. The result is non-nil
+// unless validation failed and has the state of every item so far.
+//
+// If ctx is done, the running commands are killed and Run returns ctx.Err()
+// as soon as every stage in progress stopped. The result then shows which
+// items were notarized and which requests are pending.
+func Run(ctx context.Context, opts *Options) (*Result, error) {
+	r := &runner{opts: opts, logger: opts.Logger, parent: ctx}
+	if r.logger == nil {
+		r.logger = hclog.NewNullLogger()
+	}
+
+	diags := config.Validate(opts.Config, &config.ValidateOptions{
+		Targets:      opts.Targets,
+		DontNotarize: !opts.notarize(),
+	})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	targets, err := opts.Config.SelectTargets(opts.Targets)
+	if err != nil {
+		return nil, err
+	}
+
+	r.total, r.notarizeTimeout, r.commandTimeout, err = opts.Config.Timeouts.Durations()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Timeout > 0 {
+		r.total = opts.Timeout
+	}
+	if opts.NotarizeTimeout > 0 {
+		r.notarizeTimeout = opts.NotarizeTimeout
+	}
+	if opts.CommandTimeout > 0 {
+		r.commandTimeout = opts.CommandTimeout
+	}
+	if r.total > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.total)
+		defer cancel()
+	}
+
+	if opts.StateFile != "" {
+		state := &State{}
+		if opts.Resume {
+			if state, err = LoadState(opts.StateFile); err != nil {
+				return nil, err
+			}
+		}
+
+		r.state = &stateFile{path: opts.StateFile, state: state}
+		if !opts.Resume {
+			if err := r.state.reset(); err != nil {
+				r.logger.Warn("error saving state file", "err", err)
+			}
+		}
+	}
+
+	// Sign & package every target as configured first. The files to
+	// notarize are collected as we go. The temporary keychain, if any, is
+	// only kept while signing.
+	result := &Result{}
+	err = r.createKeychain(ctx, targets)
+	if r.parent.Err() != nil {
+		return result, r.parent.Err()
+	}
+	if err != nil {
+		return result, err
+	}
+	defer r.deleteKeychain()
+
+	credentials := map[*config.AppleId]*config.AppleId{}
+	for _, t := range targets {
+		creds, ok := credentials[t.AppleId]
+		if !ok {
+			creds = &config.AppleId{}
+			if t.AppleId != nil {
+				*creds = *t.AppleId
+			}
+			creds.ApplyEnv()
+			credentials[t.AppleId] = creds
+		}
+
+		items, err := r.target(ctx, t, creds)
+		result.Items = append(result.Items, items...)
+		if r.parent.Err() != nil {
+			return result, r.parent.Err()
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+	r.deleteKeychain()
+
+	// If we're only signing and packaging or there's nothing to notarize
+	// we're done.
+	if !opts.notarize() || len(result.Items) == 0 {
+		return result, nil
+	}
+
+	err = r.notarize(ctx, result.Items)
+	if err != nil && r.parent.Err() != nil {
+		return result, r.parent.Err()
+	}
+
+	return result, err
+}
+
+// target signs and packages the files of a target and returns the items
+// to notarize.
+func (r *runner) target(ctx context.Context, t *config.Target, creds *config.AppleId) ([]*Item, error) {
+	logger := r.logger
+	if t.Name != "" {
+		r.emit(Event{Kind: EventTarget, Target: t.Name})
+		logger = logger.Named(t.Name)
+	}
+
+	// Notarize is an alternative to "Source", where you specify
+	// a single .pkg or .zip that is ready for notarization and stapling
+	var items []*Item
+	for _, c := range t.Notarize {
+		bundleId := c.BundleId
+		if bundleId == "" {
+			bundleId = t.BundleId
+		}
+
+		items = append(items, &Item{
+			Path:     c.Path,
+			BundleId: bundleId,
+			Staple:   c.Staple,
+			Target:   t.Name,
+			AppleId:  creds,
+		})
+	}
+
+	// If we're not in source mode there is nothing to sign & package
+	if len(t.Source) == 0 {
+		return items, nil
+	}
+
+	// The identity is looked up once, by the first stage that needs it
+	var identity string
+	signingIdentity := func(stage Stage) (string, error) {
+		if identity != "" {
+			return identity, nil
+		}
+
+		var err error
+		identity, err = r.identity(ctx, t, stage, creds, logger)
+		return identity, err
+	}
+
+	if t.Sign != nil && r.opts.runs(StageSign) {
+		err := r.stage(ctx, t, StageSign, "", t.Source, nil, func() error {
+			id, err := signingIdentity(StageSign)
+			if err != nil {
+				return err
+			}
+
+			var rules []sign.Rule
+			for _, rule := range t.Sign.Rule {
+				rules = append(rules, sign.Rule{
+					Paths:          rule.Paths,
+					Identity:       rule.ApplicationIdentity,
+					Entitlements:   rule.EntitlementsFile,
+					Identifier:     rule.Identifier,
+					RuntimeOptions: rule.Options,
+				})
+			}
+
+			return sign.Sign(ctx, &sign.Options{
+				Files:                 t.Source,
+				Identity:              id,
+				Entitlements:          t.Sign.EntitlementsFile,
+				Identifier:            t.Sign.Identifier,
+				BundleId:              t.BundleId,
+				Prefix:                t.Sign.Prefix,
+				Keychain:              r.signKeychain(t),
+				Timestamp:             t.Sign.Timestamp,
+				RuntimeOptions:        t.Sign.Options,
+				PreserveMetadata:      t.Sign.PreserveMetadata,
+				StripDisallowedXattrs: t.Sign.StripDisallowedXattrs,
+				ExtraArgs:             t.Sign.ExtraArgs,
+				Rules:                 rules,
+				Deep:                  t.Sign.Deep,
+				Logger:                logger.Named("sign"),
+				Timeout:               r.commandTimeout,
+			})
+		})
+		if err != nil {
+			return items, fmt.Errorf("error signing files: %w", err)
+		}
+	}
+
+	if t.Zip != nil && r.opts.runs(StageZip) {
+		err := r.stage(ctx, t, StageZip, t.Zip.OutputPath, []string{t.Zip.OutputPath}, t.Source, func() error {
+			return zip.Zip(ctx, &zip.Options{
+				Files:      t.Source,
+				OutputPath: t.Zip.OutputPath,
+				Logger:     logger.Named("zip"),
+				Timeout:    r.commandTimeout,
+			})
+		})
+		if err != nil {
+			return items, fmt.Errorf("error creating zip archive: %w", err)
+		}
+
+		items = append(items, &Item{
+			Path:     t.Zip.OutputPath,
+			BundleId: t.BundleId,
+			Target:   t.Name,
+			AppleId:  creds,
+		})
+	}
+
+	if t.Dmg != nil && t.Sign != nil && r.opts.runs(StageDmg) {
+		// First create the dmg itself. This passes in the signed files.
+		err := r.stage(ctx, t, StageDmg, t.Dmg.OutputPath, []string{t.Dmg.OutputPath}, t.Source, func() error {
+			return dmg.Dmg(ctx, &dmg.Options{
+				Files:              t.Source,
+				OutputPath:         t.Dmg.OutputPath,
+				VolumeName:         t.Dmg.VolumeName,
+				SkipPrettification: t.Dmg.SkipPrettification,
+				Logger:             logger.Named("dmg"),
+				Timeout:            r.commandTimeout,
+			})
+		})
+		if err != nil {
+			return items, fmt.Errorf("error creating dmg: %w", err)
+		}
+
+		// Next we need to sign the actual DMG as well
+		err = r.stage(ctx, t, StageSignDmg, t.Dmg.OutputPath, []string{t.Dmg.OutputPath}, nil, func() error {
+			id, err := signingIdentity(StageSignDmg)
+			if err != nil {
+				return err
+			}
+
+			return sign.Sign(ctx, &sign.Options{
+				Files:     []string{t.Dmg.OutputPath},
+				Identity:  id,
+				Keychain:  r.signKeychain(t),
+				Timestamp: t.Sign.Timestamp,
+				Logger:    logger.Named("dmg"),
+				Timeout:   r.commandTimeout,
+			})
+		})
+		if err != nil {
+			return items, fmt.Errorf("error signing dmg: %w", err)
+		}
+
+		items = append(items, &Item{
+			Path:     t.Dmg.OutputPath,
+			BundleId: t.BundleId,
+			Staple:   true,
+			Target:   t.Name,
+			AppleId:  creds,
+		})
+	}
+
+	return items, nil
+}
+
+// stage runs f surrounded by the events of the stage, and records that
+// the files finished the stage, made from inputs if any. If all the files
+// already finished the stage in an earlier run and neither they nor their
+// inputs changed since, or ctx is done, f isn't run.
+func (r *runner) stage(ctx context.Context, t *config.Target, stage Stage, path string, files, inputs []string, f func() error) error {
+	skip := r.state != nil
+	for _, file := range files {
+		skip = skip && r.state.reached(t.Name, file, stage)
+	}
+	if skip {
+		r.emit(Event{Kind: EventSkipped, Stage: stage, Target: t.Name, Path: path})
+		return nil
+	}
+
+	pending := TimeoutError{Stage: stage, Target: t.Name, Path: path}
+	if err := ctx.Err(); err != nil {
+		return r.timeout(ctx, nil, err, pending)
+	}
+
+	r.emit(Event{Kind: EventStarted, Stage: stage, Target: t.Name, Path: path})
+	if err := f(); err != nil {
+		err = r.timeout(ctx, nil, err, pending)
+		r.emit(Event{Kind: EventFailed, Stage: stage, Target: t.Name, Path: path, Err: err})
+		return err
+	}
+
+	for _, file := range files {
+		r.record(t.Name, file, stage, inputs)
+	}
+
+	r.emit(Event{Kind: EventFinished, Stage: stage, Target: t.Name, Path: path})
+	return nil
+}
+
+// record records that the file finished the stage, made from inputs if
+// any. Failing to save the state doesn't fail the run, it is only logged.
+func (r *runner) record(target, path string, stage Stage, inputs []string) {
+	if err := r.state.finished(target, path, stage, inputs); err != nil {
+		r.logger.Warn("error saving state file", "path", path, "stage", stage, "err", err)
+	}
+}
+
+// notarize notarizes and staples all the items concurrently.
+func (r *runner) notarize(ctx context.Context, items []*Item) error {
+	r.emit(Event{Kind: EventStarted, Stage: StageNotarize, Items: items})
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var totalErr error
+	for _, it := range items {
+		wg.Add(1)
+		go func(it *Item) {
+			defer wg.Done()
+
+			if err := it.notarize(ctx, r); err != nil {
+				lock.Lock()
+				defer lock.Unlock()
+				totalErr = multierror.Append(totalErr, err)
+			}
+		}(it)
+	}
+
+	// Wait for notarization to happen
+	wg.Wait()
+
+	if totalErr != nil {
+		r.emit(Event{Kind: EventFailed, Stage: StageNotarize, Items: items, Err: totalErr})
+		return totalErr
+	}
+
+	r.emit(Event{Kind: EventFinished, Stage: StageNotarize, Items: items})
+	return nil
+}
+
+// emit sends an event to the callback, if any.
+func (r *runner) emit(e Event) {
+	if r.opts.Events == nil {
+		return
+	}
+
+	r.eventLock.Lock()
+	defer r.eventLock.Unlock()
+	r.opts.Events(e)
+}
@@ -0,0 +1,197 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bi-zone/gon/config"
+)
+
+func testConfig(t *testing.T, src string) *config.Config {
+	cfg, err := config.Parse(strings.NewReader(src), "config.hcl", "")
+	require.NoError(t, err)
+	return cfg
+}
+
+func TestRun_dontNotarize(t *testing.T) {
+	require := require.New(t)
+
+	os.Setenv("AC_PROVIDER", "provider")
+	defer os.Unsetenv("AC_PROVIDER")
+
+	cfg := testConfig(t, `
+bundle_id = "com.example.app"
+
+notarize {
+  path      = "app.pkg"
+  bundle_id = ""
+  staple    = true
+}
+
+target "helper" {
+  notarize {
+    path      = "helper.zip"
+    bundle_id = "com.example.helper"
+  }
+}
+`)
+
+	var events []Event
+	result, err := Run(context.Background(), &Options{
+		Config:       cfg,
+		DontNotarize: true,
+		Events:       func(e Event) { events = append(events, e) },
+	})
+	require.NoError(err)
+	require.Len(result.Items, 2)
+
+	app := result.Items[0]
+	require.Equal("app.pkg", app.Path)
+	require.Equal("com.example.app", app.BundleId)
+	require.True(app.Staple)
+	require.Empty(app.Target)
+	require.Equal("provider", app.AppleId.Provider)
+	require.False(app.Notarized)
+
+	helper := result.Items[1]
+	require.Equal("helper", helper.Target)
+	require.Equal("com.example.helper", helper.BundleId)
+	require.True(app.AppleId == helper.AppleId, "targets should share the credentials")
+
+	// The environment defaults aren't applied to the configuration
+	require.Nil(cfg.AppleId)
+
+	require.Equal([]Event{{Kind: EventTarget, Target: "helper"}}, events)
+}
+
+func TestRun_invalid(t *testing.T) {
+	cfg := testConfig(t, `
+source = ["./app"]
+`)
+
+	result, err := Run(context.Background(), &Options{
+		Config:       cfg,
+		DontNotarize: true,
+	})
+	require.Nil(t, result)
+	require.Error(t, err)
+
+	diags, ok := err.(hcl.Diagnostics)
+	require.True(t, ok)
+	require.True(t, diags.HasErrors())
+}
+
+func TestRun_signError(t *testing.T) {
+	require := require.New(t)
+
+	cfg := testConfig(t, `
+source    = ["./does-not-exist"]
+bundle_id = "com.example.app"
+
+sign {
+  application_identity = "foo"
+}
+
+zip {
+  output_path = "app.zip"
+}
+`)
+
+	var events []Event
+	result, err := Run(context.Background(), &Options{
+		Config:       cfg,
+		DontNotarize: true,
+		Events:       func(e Event) { events = append(events, e) },
+	})
+	require.Error(err)
+	require.Empty(result.Items)
+
+	// Packaging doesn't start after signing failed
+	require.Len(events, 2)
+	require.Equal(EventStarted, events[0].Kind)
+	require.Equal(StageSign, events[0].Stage)
+	require.Equal(EventFailed, events[1].Kind)
+	require.Equal(StageSign, events[1].Stage)
+	require.Error(events[1].Err)
+}
+
+func TestRun_keychainError(t *testing.T) {
+	require := require.New(t)
+
+	cfg := testConfig(t, `
+source    = ["./app"]
+bundle_id = "com.example.app"
+
+sign {
+  application_identity = "foo"
+}
+
+keychain {
+  p12_content = "not base64!"
+}
+`)
+
+	var events []Event
+	result, err := Run(context.Background(), &Options{
+		Config:       cfg,
+		DontNotarize: true,
+		Events:       func(e Event) { events = append(events, e) },
+	})
+	require.Error(err)
+	require.NotNil(result)
+
+	// Nothing is signed without the keychain
+	require.Len(events, 2)
+	require.Equal(EventStarted, events[0].Kind)
+	require.Equal(StageKeychain, events[0].Stage)
+	require.Equal(EventFailed, events[1].Kind)
+	require.Equal(StageKeychain, events[1].Stage)
+
+	// The keychain isn't needed if nothing is signed
+	events = nil
+	_, err = Run(context.Background(), &Options{
+		Config:       cfg,
+		DontNotarize: true,
+		Stages:       []Stage{StageZip},
+		Events:       func(e Event) { events = append(events, e) },
+	})
+	require.NoError(err)
+	require.Empty(events)
+}
+
+func TestRun_canceled(t *testing.T) {
+	require := require.New(t)
+
+	cfg := testConfig(t, `
+source    = ["./app"]
+bundle_id = "com.example.app"
+
+sign {
+  application_identity = "foo"
+}
+
+zip {
+  output_path = "app.zip"
+}
+`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var events []Event
+	result, err := Run(ctx, &Options{
+		Config:       cfg,
+		DontNotarize: true,
+		Events:       func(e Event) { events = append(events, e) },
+	})
+	require.Equal(context.Canceled, err)
+	require.NotNil(result)
+
+	// No stage starts once canceled
+	require.Empty(events)
+}
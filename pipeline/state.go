@@ -0,0 +1,288 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// State is the progress of a run as saved to Options.StateFile. It lets
+// a later run resume where an interrupted one stopped.
+type State struct {
+	Artifacts []*Artifact `json:"artifacts"`
+}
+
+// Artifact is the progress of a single file: a source file, an archive
+// or a file to notarize.
+type Artifact struct {
+	// Target is the name of the target the file belongs to.
+	Target string `json:"target,omitempty"`
+
+	// Path is the path of the file as given in the configuration.
+	Path string `json:"path"`
+
+	// SHA256 is the hash of the file when Stage was reached. For
+	// directories, such as app bundles, it covers the names and contents
+	// of all the files in it.
+	SHA256 string `json:"sha256"`
+
+	// Stage is the last stage finished for the file, empty if none.
+	Stage Stage `json:"stage,omitempty"`
+
+	// Inputs are the hashes of the files the file was made from, such as
+	// the source files of an archive, by path. If any of them changed, the
+	// file is out of date and all its stages run again.
+	Inputs map[string]string `json:"inputs,omitempty"`
+
+	// RequestUUID is the notarization request UUID once the file was
+	// submitted.
+	RequestUUID string `json:"request_uuid,omitempty"`
+}
+
+// stageOrder orders the stages a file goes through.
+var stageOrder = map[Stage]int{
+	StageSign:     1,
+	StageZip:      1,
+	StageDmg:      1,
+	StageSignDmg:  2,
+	StageNotarize: 3,
+	StageStaple:   4,
+}
+
+// LoadState reads a state file. A missing file is an empty state.
+func LoadState(path string) (*State, error) {
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state State
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, fmt.Errorf("error decoding state file %s: %w", path, err)
+	}
+
+	return &state, nil
+}
+
+// stateFile tracks the progress of a run and saves it to a file as it
+// changes. A nil stateFile tracks nothing.
+type stateFile struct {
+	path string
+
+	lock  sync.Mutex
+	state *State
+}
+
+// artifact returns the artifact for the file, nil if there is none.
+// The lock must be held.
+func (s *stateFile) artifact(target, path string) *Artifact {
+	for _, a := range s.state.Artifacts {
+		if a.Target == target && a.Path == path {
+			return a
+		}
+	}
+
+	return nil
+}
+
+// lookup returns a copy of the artifact for the file if neither the file
+// nor its inputs were changed since it was recorded.
+func (s *stateFile) lookup(target, path string) (*Artifact, bool) {
+	if s == nil {
+		return nil, false
+	}
+
+	s.lock.Lock()
+	a := s.artifact(target, path)
+	s.lock.Unlock()
+	if a == nil {
+		return nil, false
+	}
+
+	sum, err := hashPath(path)
+	if err != nil || sum != a.SHA256 {
+		return nil, false
+	}
+	for input, recorded := range a.Inputs {
+		sum, err := hashPath(input)
+		if err != nil || sum != recorded {
+			return nil, false
+		}
+	}
+
+	result := *a
+	return &result, true
+}
+
+// reached returns true if the file reached the stage in an earlier run
+// and neither it nor its inputs were changed since.
+func (s *stateFile) reached(target, path string, stage Stage) bool {
+	a, ok := s.lookup(target, path)
+	return ok && stageOrder[a.Stage] >= stageOrder[stage]
+}
+
+// finished records that the file finished the stage and saves the state.
+// If the stage made the file from inputs, their hashes are recorded too,
+// otherwise those of an earlier stage are kept.
+func (s *stateFile) finished(target, path string, stage Stage, inputs []string) error {
+	if s == nil {
+		return nil
+	}
+
+	var sums map[string]string
+	if len(inputs) > 0 {
+		sums = map[string]string{}
+		for _, input := range inputs {
+			sum, err := hashPath(input)
+			if err != nil {
+				return err
+			}
+			sums[input] = sum
+		}
+	}
+
+	return s.update(target, path, func(a *Artifact) {
+		a.Stage = stage
+		if sums != nil {
+			a.Inputs = sums
+		}
+	})
+}
+
+// submitted records the request UUID the file was submitted with and
+// saves the state.
+func (s *stateFile) submitted(target, path, uuid string) error {
+	return s.update(target, path, func(a *Artifact) {
+		a.RequestUUID = uuid
+	})
+}
+
+// update updates the artifact for the file with its current hash and
+// saves the state.
+func (s *stateFile) update(target, path string, f func(*Artifact)) error {
+	if s == nil {
+		return nil
+	}
+
+	sum, err := hashPath(path)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	a := s.artifact(target, path)
+	if a == nil {
+		a = &Artifact{Target: target, Path: path}
+		s.state.Artifacts = append(s.state.Artifacts, a)
+	}
+	a.SHA256 = sum
+	f(a)
+
+	return s.save()
+}
+
+// reset saves the state, replacing the progress of earlier runs.
+func (s *stateFile) reset() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.save()
+}
+
+// save writes the state file, replacing it atomically. The lock must
+// be held.
+func (s *stateFile) save() error {
+	raw, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(raw); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path)
+}
+
+// hashPath returns the hex encoded SHA-256 of a file. For a directory it
+// is the hash of the relative paths and hashes of all regular files in it,
+// in lexical order.
+func hashPath(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	if !fi.IsDir() {
+		return hashFile(path)
+	}
+
+	var files []string
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, p := range files {
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return "", err
+		}
+
+		sum, err := hashFile(p)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(h, "%s\x00%s\n", filepath.ToSlash(rel), sum)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFile returns the hex encoded SHA-256 of a regular file.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bi-zone/gon/config"
+)
+
+func TestHashPath(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "gon")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	app := filepath.Join(dir, "App.app")
+	require.NoError(os.MkdirAll(filepath.Join(app, "Contents", "MacOS"), 0755))
+	bin := filepath.Join(app, "Contents", "MacOS", "App")
+	require.NoError(ioutil.WriteFile(bin, []byte("binary"), 0644))
+
+	// A file is the plain hash of its contents
+	sum, err := hashPath(bin)
+	require.NoError(err)
+	require.Equal("9a3a45d01531a20e89ac6ae10b0b0beb0492acd7216a368aa062d1a5fecaf9cd", sum)
+
+	// A directory changes with the contents and names of its files
+	dirSum, err := hashPath(app)
+	require.NoError(err)
+	require.NotEqual(sum, dirSum)
+
+	require.NoError(ioutil.WriteFile(bin, []byte("signed binary"), 0644))
+	changed, err := hashPath(app)
+	require.NoError(err)
+	require.NotEqual(dirSum, changed)
+
+	require.NoError(os.Rename(bin, bin+"2"))
+	renamed, err := hashPath(app)
+	require.NoError(err)
+	require.NotEqual(changed, renamed)
+}
+
+func TestStateFile(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "gon")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.zip")
+	require.NoError(ioutil.WriteFile(path, []byte("zip"), 0644))
+
+	s := &stateFile{path: filepath.Join(dir, "state.json"), state: &State{}}
+	require.False(s.reached("", path, StageZip))
+
+	require.NoError(s.finished("", path, StageZip, nil))
+	require.NoError(s.submitted("", path, "uuid"))
+	require.True(s.reached("", path, StageZip))
+	require.False(s.reached("", path, StageNotarize))
+	require.False(s.reached("other", path, StageZip))
+
+	// The state is saved as it goes
+	loaded, err := LoadState(s.path)
+	require.NoError(err)
+	require.Len(loaded.Artifacts, 1)
+	require.Equal(path, loaded.Artifacts[0].Path)
+	require.Equal(StageZip, loaded.Artifacts[0].Stage)
+	require.Equal("uuid", loaded.Artifacts[0].RequestUUID)
+
+	// A changed file starts over
+	require.NoError(ioutil.WriteFile(path, []byte("new zip"), 0644))
+	require.False(s.reached("", path, StageZip))
+	_, ok := s.lookup("", path)
+	require.False(ok)
+
+	// A missing state file is empty
+	loaded, err = LoadState(filepath.Join(dir, "nope.json"))
+	require.NoError(err)
+	require.Empty(loaded.Artifacts)
+}
+
+func TestStateFile_inputs(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "gon")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "app")
+	zip := filepath.Join(dir, "app.zip")
+	require.NoError(ioutil.WriteFile(src, []byte("app"), 0644))
+	require.NoError(ioutil.WriteFile(zip, []byte("zip"), 0644))
+
+	// The zip was made from the source and notarized
+	s := &stateFile{path: filepath.Join(dir, "state.json"), state: &State{}}
+	require.NoError(s.finished("", zip, StageZip, []string{src}))
+	require.NoError(s.finished("", zip, StageNotarize, nil))
+	require.True(s.reached("", zip, StageZip))
+	require.True(s.reached("", zip, StageNotarize))
+
+	// The inputs are kept by later stages
+	a, ok := s.lookup("", zip)
+	require.True(ok)
+	require.Len(a.Inputs, 1)
+
+	// A rebuilt source makes the zip and all later stages out of date,
+	// even though the zip itself is unchanged
+	require.NoError(ioutil.WriteFile(src, []byte("new app"), 0644))
+	require.False(s.reached("", zip, StageZip))
+	require.False(s.reached("", zip, StageNotarize))
+
+	// Making the zip again starts its later stages over
+	require.NoError(s.finished("", zip, StageZip, []string{src}))
+	require.True(s.reached("", zip, StageZip))
+	require.False(s.reached("", zip, StageNotarize))
+
+	// A missing input is a change too
+	require.NoError(os.Remove(src))
+	require.False(s.reached("", zip, StageZip))
+}
+
+func TestRun_resume(t *testing.T) {
+	require := require.New(t)
+
+	os.Setenv("AC_PASSWORD", "secret")
+	defer os.Unsetenv("AC_PASSWORD")
+
+	dir, err := ioutil.TempDir("", "gon")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "app")
+	pkg := filepath.Join(dir, "app.pkg")
+	require.NoError(ioutil.WriteFile(src, []byte("app"), 0644))
+	require.NoError(ioutil.WriteFile(pkg, []byte("pkg"), 0644))
+
+	// An earlier run signed the source and notarized the package
+	statePath := filepath.Join(dir, "state.json")
+	s := &stateFile{path: statePath, state: &State{}}
+	require.NoError(s.finished("", src, StageSign, nil))
+	require.NoError(s.submitted("", pkg, "uuid"))
+	require.NoError(s.finished("", pkg, StageNotarize, nil))
+
+	cfg := &config.Config{
+		Source:   []string{src},
+		BundleId: "com.example.app",
+		Sign:     &config.Sign{ApplicationIdentity: "foo"},
+		Notarize: []config.Notarize{{Path: pkg}},
+		AppleId:  &config.AppleId{Username: "foo@example.com"},
+	}
+
+	// Nothing is left to do, so nothing is executed
+	var events []Event
+	result, err := Run(context.Background(), &Options{
+		Config:    cfg,
+		StateFile: statePath,
+		Resume:    true,
+		Events:    func(e Event) { events = append(events, e) },
+	})
+	require.NoError(err)
+	require.Len(result.Items, 1)
+	require.True(result.Items[0].Notarized)
+	require.Equal("uuid", result.Items[0].RequestUUID)
+
+	require.Equal(EventSkipped, events[0].Kind)
+	require.Equal(StageSign, events[0].Stage)
+
+	// Without resuming the state starts over
+	_, err = Run(context.Background(), &Options{
+		Config:       cfg,
+		StateFile:    statePath,
+		DontNotarize: true,
+	})
+	require.Error(err)
+
+	state, err := LoadState(statePath)
+	require.NoError(err)
+	require.Empty(state.Artifacts)
+}
@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/bi-zone/gon/internal/execctx"
+)
+
+// The timeouts of a run, see TimeoutError.
+const (
+	TimeoutTotal    = "total"
+	TimeoutNotarize = "notarize"
+	TimeoutCommand  = "command"
+)
+
+// TimeoutError is the error of a stage or item that didn't finish because
+// a timeout expired. errors.Is reports it as context.DeadlineExceeded.
+type TimeoutError struct {
+	// Timeout is the timeout that expired: TimeoutTotal, TimeoutNotarize
+	// or TimeoutCommand. Duration is its value.
+	Timeout  string
+	Duration time.Duration
+
+	// Stage, Target and Path are what was pending. Path is empty for
+	// StageSign, which signs all the source files.
+	Stage  Stage
+	Target string
+	Path   string
+
+	// RequestUUID is the notarization request that was pending, if the
+	// file was already submitted.
+	RequestUUID string
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	what := string(e.Stage)
+	if e.Path != "" {
+		what += " of " + e.Path
+	}
+	if e.Target != "" {
+		what += fmt.Sprintf(" in target %q", e.Target)
+	}
+	if e.RequestUUID != "" {
+		what += fmt.Sprintf(" (request UUID %s)", e.RequestUUID)
+	}
+
+	return fmt.Sprintf("%s didn't finish within the %s timeout of %s", what, e.Timeout, e.Duration)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// IsTimeout returns true if err is caused by a timeout. For the combined
+// error of notarizing several items, it is true only if every item failed
+// because of a timeout, so a timeout doesn't hide an actual failure.
+func IsTimeout(err error) bool {
+	if merr, ok := err.(*multierror.Error); ok {
+		for _, err := range merr.Errors {
+			if !IsTimeout(err) {
+				return false
+			}
+		}
+
+		return len(merr.Errors) > 0
+	}
+
+	var terr *TimeoutError
+	return errors.As(err, &terr)
+}
+
+// timeout returns err as a *TimeoutError if it's caused by one of the
+// timeouts of the run, and err as is otherwise. ctx is the context of the
+// run and limited, if non-nil, the context limited by the notarize timeout.
+func (r *runner) timeout(ctx, limited context.Context, err error, e TimeoutError) error {
+	if !errors.Is(err, context.DeadlineExceeded) || r.parent.Err() != nil {
+		return err
+	}
+
+	var cmdErr *execctx.TimeoutError
+	switch {
+	case ctx.Err() != nil:
+		e.Timeout, e.Duration = TimeoutTotal, r.total
+	case limited != nil && limited.Err() != nil:
+		e.Timeout, e.Duration = TimeoutNotarize, r.notarizeTimeout
+	case errors.As(err, &cmdErr):
+		e.Timeout, e.Duration = TimeoutCommand, cmdErr.Timeout
+	default:
+		return err
+	}
+
+	e.Err = err
+	return &e
+}
@@ -0,0 +1,83 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bi-zone/gon/config"
+)
+
+func TestRun_timeout(t *testing.T) {
+	os.Setenv("AC_PASSWORD", "secret")
+	defer os.Unsetenv("AC_PASSWORD")
+
+	dir, err := ioutil.TempDir("", "gon")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pkg := filepath.Join(dir, "app.pkg")
+	require.NoError(t, ioutil.WriteFile(pkg, []byte("pkg"), 0644))
+
+	// An earlier run submitted the package, so we go straight to waiting
+	statePath := filepath.Join(dir, "state.json")
+	s := &stateFile{path: statePath, state: &State{}}
+	require.NoError(t, s.submitted("", pkg, "uuid"))
+
+	cfg := &config.Config{
+		Notarize: []config.Notarize{{Path: pkg}},
+		AppleId:  &config.AppleId{Username: "foo@example.com"},
+	}
+
+	cases := []struct {
+		Name    string
+		Opts    Options
+		Timeout string
+	}{
+		{"notarize", Options{NotarizeTimeout: 50 * time.Millisecond}, TimeoutNotarize},
+		{"total", Options{Timeout: 50 * time.Millisecond}, TimeoutTotal},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require := require.New(t)
+
+			interval := time.Hour
+			opts := tc.Opts
+			opts.Config = cfg
+			opts.StateFile = statePath
+			opts.Resume = true
+			opts.PollingInterval = &interval
+
+			result, err := Run(context.Background(), &opts)
+			require.Error(err)
+			require.True(IsTimeout(err))
+			require.True(errors.Is(result.Items[0].NotarizeError, context.DeadlineExceeded))
+
+			var terr *TimeoutError
+			require.True(errors.As(result.Items[0].NotarizeError, &terr))
+			require.Equal(tc.Timeout, terr.Timeout)
+			require.Equal(StageNotarize, terr.Stage)
+			require.Equal(pkg, terr.Path)
+			require.Equal("uuid", terr.RequestUUID)
+		})
+	}
+}
+
+func TestIsTimeout(t *testing.T) {
+	timeout := &TimeoutError{Timeout: TimeoutCommand, Err: context.DeadlineExceeded}
+	other := errors.New("package is invalid")
+
+	require.True(t, IsTimeout(timeout))
+	require.False(t, IsTimeout(other))
+	require.False(t, IsTimeout(context.DeadlineExceeded))
+	require.True(t, IsTimeout(multierror.Append(nil, timeout, timeout)))
+	require.False(t, IsTimeout(multierror.Append(nil, timeout, other)))
+}
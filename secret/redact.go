@@ -0,0 +1,130 @@
+package secret
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Redacted replaces secrets in logged command lines and error messages.
+const Redacted = "<redacted>"
+
+// flags are the command line flags whose value is a secret: the password
+// of notarytool, and the keychain and file passwords of security.
+var flags = map[string]bool{
+	"--password": true,
+	"-p":         true,
+	"-P":         true,
+}
+
+// known are the secrets Redact replaces, see Register.
+var (
+	knownLock sync.RWMutex
+	known     = map[string]struct{}{}
+)
+
+// minLength is the length of the shortest secret Redact replaces wherever
+// it appears. A shorter one, such as a placeholder password, would garble
+// unrelated words, so it's only replaced where it's a whole word, or a
+// whole argument in RedactArgs.
+const minLength = 6
+
+// Register adds value to the secrets that Redact and RedactArgs replace.
+// Resolve registers the secrets it resolves, so this is only needed for
+// secrets that are given as is.
+func Register(value string) {
+	if value == "" {
+		return
+	}
+
+	knownLock.Lock()
+	defer knownLock.Unlock()
+	known[value] = struct{}{}
+}
+
+// Redact returns s with the registered secrets replaced by Redacted.
+// Secrets shorter than six characters are only replaced where they're a
+// whole word.
+func Redact(s string) string {
+	knownLock.RLock()
+	values := make([]string, 0, len(known))
+	for value := range known {
+		values = append(values, value)
+	}
+	knownLock.RUnlock()
+
+	// Longer secrets first so a secret containing another is replaced whole
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	for _, value := range values {
+		if len(value) < minLength {
+			s = replaceWord(s, value)
+		} else {
+			s = strings.Replace(s, value, Redacted, -1)
+		}
+	}
+
+	return s
+}
+
+// replaceWord returns s with the occurrences of value that aren't part of
+// a longer word replaced by Redacted.
+func replaceWord(s, value string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, value)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+
+		end := i + len(value)
+		before, _ := utf8.DecodeLastRuneInString(s[:i])
+		after, _ := utf8.DecodeRuneInString(s[end:])
+		b.WriteString(s[:i])
+		if isWord(before) || isWord(after) {
+			b.WriteString(value)
+		} else {
+			b.WriteString(Redacted)
+		}
+		s = s[end:]
+	}
+}
+
+// isWord returns true if r is part of a word. It's false for the
+// utf8.RuneError of an empty string.
+func isWord(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// isKnown returns true if value is a registered secret.
+func isKnown(value string) bool {
+	knownLock.RLock()
+	defer knownLock.RUnlock()
+	_, ok := known[value]
+	return ok
+}
+
+// RedactArgs returns a copy of a command line that is safe to log: the
+// values of password flags and the registered secrets are replaced by
+// Redacted.
+func RedactArgs(args []string) []string {
+	result := make([]string, len(args))
+	for i, arg := range args {
+		switch {
+		case i > 0 && flags[args[i-1]]:
+			result[i] = Redacted
+		case strings.HasPrefix(arg, "--password="):
+			result[i] = "--password=" + Redacted
+		case isKnown(arg):
+			result[i] = Redacted
+		default:
+			result[i] = Redact(arg)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,56 @@
+package secret
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactArgs(t *testing.T) {
+	args := []string{
+		"xcrun", "notarytool", "submit", "app.zip",
+		"--apple-id", "foo@example.com",
+		"--password", "hunter2",
+	}
+	require.Equal(t, []string{
+		"xcrun", "notarytool", "submit", "app.zip",
+		"--apple-id", "foo@example.com",
+		"--password", Redacted,
+	}, RedactArgs(args))
+	require.Equal(t, "hunter2", args[7], "the arguments aren't modified")
+
+	require.Equal(t,
+		[]string{"security", "create-keychain", "-p", Redacted, "ci.keychain"},
+		RedactArgs([]string{"security", "create-keychain", "-p", "s3cret", "ci.keychain"}))
+	require.Equal(t,
+		[]string{"notarytool", "--password=" + Redacted},
+		RedactArgs([]string{"notarytool", "--password=hunter2"}))
+}
+
+func TestRedact(t *testing.T) {
+	os.Setenv("GON_TEST_REDACT", "correct horse")
+	defer os.Unsetenv("GON_TEST_REDACT")
+
+	// Resolved secrets are redacted, as are registered ones
+	_, err := Resolve(context.Background(), "@env:GON_TEST_REDACT", nil)
+	require.NoError(t, err)
+	Register("battery staple")
+
+	err = errors.New("invalid password correct horse or battery staple")
+	require.Equal(t, "invalid password <redacted> or <redacted>", Redact(err.Error()))
+
+	// Short values are only replaced as whole words and arguments, so they
+	// don't garble unrelated output
+	Register("abc")
+	require.Equal(t, "abcd and xabc", Redact("abcd and xabc"))
+	require.Equal(t, "invalid password <redacted>.", Redact("invalid password abc."))
+	require.Equal(t,
+		[]string{"tool", "-p", Redacted, "--token", Redacted, "abcd.zip"},
+		RedactArgs([]string{"tool", "-p", "abc", "--token", "abc", "abcd.zip"}))
+	require.Equal(t,
+		[]string{"tool", "--token=" + Redacted},
+		RedactArgs([]string{"tool", "--token=battery staple"}))
+}
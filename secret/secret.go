@@ -0,0 +1,129 @@
+// Package secret resolves references to secrets, so configurations don't
+// have to contain them. A reference is one of:
+//
+//	@env:NAME       the value of the environment variable NAME
+//	@keychain:NAME  the password of the generic password item with the
+//	                service NAME in the macOS keychain
+//	@file:PATH      the contents of the file at PATH, without the trailing
+//	                newline
+//
+// Any other value is used as is.
+//
+// The package also keeps the secrets out of logs and error messages, see
+// Redact and RedactArgs.
+package secret
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/bi-zone/gon/internal/execctx"
+	"github.com/bi-zone/gon/internal/securitycmd"
+)
+
+// The prefixes of the kinds of references.
+const (
+	PrefixEnv      = "@env:"
+	PrefixKeychain = "@keychain:"
+	PrefixFile     = "@file:"
+)
+
+// Options are the options for Resolve.
+type Options struct {
+	// Logger is the logger to use. If this is nil then no logging will be done.
+	// The secrets themselves are never logged.
+	Logger hclog.Logger
+
+	// Timeout, if positive, limits how long the security command may run.
+	Timeout time.Duration
+
+	// BaseCmd is the base command for executing the security binary. This is
+	// used for tests to overwrite where the security binary is.
+	BaseCmd *exec.Cmd
+}
+
+// IsReference returns true if value is a reference rather than the secret
+// itself.
+func IsReference(value string) bool {
+	for _, prefix := range []string{PrefixEnv, PrefixKeychain, PrefixFile} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolve returns the secret value refers to, or value itself if it isn't
+// a reference. The errors name the reference that couldn't be resolved.
+// opts may be nil.
+func Resolve(ctx context.Context, value string, opts *Options) (string, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	var result string
+	var err error
+	switch {
+	case strings.HasPrefix(value, PrefixEnv):
+		name := strings.TrimPrefix(value, PrefixEnv)
+		var ok bool
+		if result, ok = os.LookupEnv(name); !ok {
+			err = fmt.Errorf("environment variable %s isn't set", name)
+		}
+
+	case strings.HasPrefix(value, PrefixKeychain):
+		result, err = keychain(ctx, strings.TrimPrefix(value, PrefixKeychain), opts)
+
+	case strings.HasPrefix(value, PrefixFile):
+		var raw []byte
+		raw, err = ioutil.ReadFile(strings.TrimPrefix(value, PrefixFile))
+		result = strings.TrimRight(string(raw), "\r\n")
+
+	default:
+		return value, nil
+	}
+
+	if err != nil {
+		if execctx.Stopped(err) {
+			return "", err
+		}
+		return "", fmt.Errorf("error resolving %s: %w", value, err)
+	}
+	if result == "" {
+		return "", fmt.Errorf("error resolving %s: the secret is empty", value)
+	}
+
+	Register(result)
+	return result, nil
+}
+
+// keychain returns the password of a generic password item in the keychain.
+func keychain(ctx context.Context, service string, opts *Options) (string, error) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+	logger.Info("reading password from keychain", "service", service)
+
+	// The password is written to stdout, which is never logged
+	out, err := securitycmd.Run(ctx, &securitycmd.Options{
+		Logger:     logger,
+		Timeout:    opts.Timeout,
+		BaseCmd:    opts.BaseCmd,
+		Redact:     Redact,
+		RedactArgs: RedactArgs,
+	}, "find-generic-password", "-s", service, "-w")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(out, "\n"), nil
+}
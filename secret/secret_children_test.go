@@ -0,0 +1,58 @@
+package secret
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// childEnv is the env var that must be set to trigger a child command.
+const childEnv = "GON_TEST_CHILD"
+
+// childCommands is the list of commands we support
+var childCommands = map[string]func() int{
+	"keychain-found":     childKeychainFound,
+	"keychain-not-found": childKeychainNotFound,
+}
+
+// childCmd is used to create a command that executes a command in the
+// childCommands map in a new process.
+func childCmd(t *testing.T, name string, args ...string) *exec.Cmd {
+	t.Helper()
+
+	// Get the path to our executable
+	selfPath, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		t.Fatalf("error creating child command: %s", err)
+		return nil
+	}
+
+	cmd := exec.Command(selfPath, args...)
+	cmd.Env = os.Environ()
+	cmd.Env = append(cmd.Env, childEnv+"="+name)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd
+}
+
+// childKeychainFound mimicks security printing the password of the item
+// with the "gon" service.
+func childKeychainFound() int {
+	if len(os.Args) != 5 || os.Args[1] != "find-generic-password" ||
+		os.Args[2] != "-s" || os.Args[3] != "gon" || os.Args[4] != "-w" {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %q\n", os.Args)
+		return 1
+	}
+
+	fmt.Println("hunter2")
+	return 0
+}
+
+// childKeychainNotFound mimicks security for a missing item.
+func childKeychainNotFound() int {
+	fmt.Fprintln(os.Stderr, "security: SecKeychainSearchCopyNext: The specified item could not be found in the keychain.")
+	return 44
+}
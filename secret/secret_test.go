@@ -0,0 +1,79 @@
+package secret
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// Set our default logger
+	logger := hclog.L()
+	logger.SetLevel(hclog.Trace)
+	hclog.SetDefault(logger)
+
+	// If we got a subcommand, run that
+	if v := os.Getenv(childEnv); v != "" && childCommands[v] != nil {
+		os.Exit(childCommands[v]())
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestResolve_plain(t *testing.T) {
+	value, err := Resolve(context.Background(), "hunter2", nil)
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", value)
+	require.False(t, IsReference("hunter2"))
+}
+
+func TestResolve_env(t *testing.T) {
+	os.Setenv("GON_TEST_SECRET", "hunter2")
+	defer os.Unsetenv("GON_TEST_SECRET")
+
+	value, err := Resolve(context.Background(), "@env:GON_TEST_SECRET", nil)
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", value)
+
+	_, err = Resolve(context.Background(), "@env:GON_TEST_MISSING", nil)
+	require.EqualError(t, err,
+		"error resolving @env:GON_TEST_MISSING: environment variable GON_TEST_MISSING isn't set")
+}
+
+func TestResolve_file(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gon")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "password")
+	require.NoError(t, ioutil.WriteFile(path, []byte("hunter2\n"), 0600))
+
+	value, err := Resolve(context.Background(), "@file:"+path, nil)
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", value)
+
+	_, err = Resolve(context.Background(), "@file:"+filepath.Join(dir, "missing"), nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error resolving @file:"+filepath.Join(dir, "missing"))
+}
+
+func TestResolve_keychain(t *testing.T) {
+	value, err := Resolve(context.Background(), "@keychain:gon", &Options{
+		Logger:  hclog.L(),
+		BaseCmd: childCmd(t, "keychain-found"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", value)
+
+	_, err = Resolve(context.Background(), "@keychain:gon", &Options{
+		Logger:  hclog.L(),
+		BaseCmd: childCmd(t, "keychain-not-found"),
+	})
+	require.EqualError(t, err, "error resolving @keychain:gon: "+
+		"security: SecKeychainSearchCopyNext: The specified item could not be found in the keychain.")
+}
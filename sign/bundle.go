@@ -0,0 +1,277 @@
+package sign
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// CodeKind is the kind of code nested in a bundle.
+type CodeKind string
+
+const (
+	// KindExecutable is a Mach-O executable other than the main executable
+	// of its bundle, such as a command line helper tool.
+	KindExecutable CodeKind = "executable"
+
+	// KindLibrary is a dynamic library.
+	KindLibrary CodeKind = "library"
+
+	// KindFramework is a framework bundle.
+	KindFramework CodeKind = "framework"
+
+	// KindXPCService is an XPC service bundle.
+	KindXPCService CodeKind = "xpc"
+
+	// KindPlugin is a plugin bundle, such as an app extension or a Quick
+	// Look generator.
+	KindPlugin CodeKind = "plugin"
+
+	// KindApp is a helper app bundle.
+	KindApp CodeKind = "app"
+)
+
+// bundleKinds are the kinds of the bundles by extension.
+var bundleKinds = map[string]CodeKind{
+	".app":             KindApp,
+	".framework":       KindFramework,
+	".xpc":             KindXPCService,
+	".appex":           KindPlugin,
+	".plugin":          KindPlugin,
+	".bundle":          KindPlugin,
+	".kext":            KindPlugin,
+	".systemextension": KindPlugin,
+	".qlgenerator":     KindPlugin,
+	".mdimporter":      KindPlugin,
+	".saver":           KindPlugin,
+	".prefPane":        KindPlugin,
+}
+
+// Code is a piece of code nested in a bundle that must be signed before
+// the bundle.
+type Code struct {
+	Path string
+	Kind CodeKind
+}
+
+// library returns true if the code is a library or a framework, which
+// have no entitlements or runtime flags of their own.
+func (c *Code) library() bool {
+	return c.Kind == KindLibrary || c.Kind == KindFramework
+}
+
+// IsBundle returns true if path is a directory with the extension of a
+// bundle that has nested code, such as an app or a framework.
+func IsBundle(path string) bool {
+	if _, ok := bundleKinds[filepath.Ext(path)]; !ok {
+		return false
+	}
+
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// Walk returns the code nested in a bundle in the order to sign it,
+// deepest first: every piece of code comes before the bundle containing
+// it. The nested bundles with code are included, but not their main
+// executables, which are signed along with them, nor the bundle itself.
+// Resource bundles without code aren't included. Symbolic links aren't
+// followed.
+func Walk(bundle string) ([]*Code, error) {
+	var result []*Code
+	if err := walk(bundle, bundle, &result); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return depth(result[i].Path) > depth(result[j].Path)
+	})
+
+	return result, nil
+}
+
+// walk adds the code in dir, which is in bundle, to result.
+func walk(bundle, dir string, result *[]*Code) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	main := bundleExecutable(bundle)
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		switch {
+		case entry.Mode()&os.ModeSymlink != 0:
+			// Framework versions and the like, signed through their target
+
+		case entry.IsDir():
+			nested := bundle
+			if kind, ok := bundleKinds[filepath.Ext(entry.Name())]; ok {
+				ok, err := hasCode(path)
+				if err != nil {
+					return err
+				}
+				if ok {
+					*result = append(*result, &Code{Path: path, Kind: kind})
+					nested = path
+				}
+			}
+
+			if err := walk(nested, path, result); err != nil {
+				return err
+			}
+
+		case entry.Mode().IsRegular():
+			if isMain(bundle, path, main) {
+				continue
+			}
+
+			ok, err := isMachO(path)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+
+			kind := KindExecutable
+			if ext := filepath.Ext(path); ext == ".dylib" || ext == ".so" {
+				kind = KindLibrary
+			}
+			*result = append(*result, &Code{Path: path, Kind: kind})
+		}
+	}
+
+	return nil
+}
+
+// errFound stops the walk of hasCode at the first Mach-O file.
+var errFound = errors.New("found")
+
+// hasCode returns true if a bundle has code to sign: an executable in
+// Contents/MacOS or a Mach-O file anywhere in it. Resource bundles, such
+// as those of localizations or assets, have none.
+func hasCode(bundle string) (bool, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(bundle, "Contents", "MacOS"))
+	if err == nil {
+		for _, entry := range entries {
+			if entry.Mode().IsRegular() {
+				return true, nil
+			}
+		}
+	}
+
+	err = filepath.Walk(bundle, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		ok, err := isMachO(path)
+		if err == nil && ok {
+			return errFound
+		}
+		return err
+	})
+	if err == errFound {
+		return true, nil
+	}
+
+	return false, err
+}
+
+// executableRe matches the main executable in an XML Info.plist.
+var executableRe = regexp.MustCompile(`<key>CFBundleExecutable</key>\s*<string>([^<]+)</string>`)
+
+// bundleExecutable returns the name of the main executable of a bundle:
+// CFBundleExecutable of its Info.plist or else the bundle name.
+func bundleExecutable(bundle string) string {
+	for _, plist := range []string{
+		filepath.Join(bundle, "Contents", "Info.plist"),
+		filepath.Join(bundle, "Resources", "Info.plist"),
+	} {
+		raw, err := ioutil.ReadFile(plist)
+		if err != nil {
+			continue
+		}
+		if m := executableRe.FindSubmatch(raw); m != nil {
+			return string(m[1])
+		}
+	}
+
+	return strings.TrimSuffix(filepath.Base(bundle), filepath.Ext(bundle))
+}
+
+// isMain returns true if path is the main executable of the bundle, in
+// Contents/MacOS for apps or in a version directory for frameworks.
+func isMain(bundle, path, main string) bool {
+	if filepath.Base(path) != main {
+		return false
+	}
+
+	rel, err := filepath.Rel(bundle, filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "Contents" && parts[1] == "MacOS":
+		return true
+	case len(parts) == 2 && parts[0] == "Versions":
+		return true
+	case len(parts) == 1 && parts[0] == ".":
+		// Shallow bundles, as on iOS
+		return true
+	}
+
+	return false
+}
+
+// The magic numbers of Mach-O and universal binaries, as read big endian.
+const (
+	magic32      = 0xfeedface
+	magic64      = 0xfeedfacf
+	cigam32      = 0xcefaedfe
+	cigam64      = 0xcffaedfe
+	magicFat     = 0xcafebabe
+	cigamFat     = 0xbebafeca
+	magicFat64   = 0xcafebabf
+	cigamFat64   = 0xbfbafeca
+	maxFatArches = 32
+)
+
+// isMachO returns true if the file is a Mach-O or universal binary.
+func isMachO(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	var header [8]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		// Too short to be a binary
+		return false, nil
+	}
+
+	switch binary.BigEndian.Uint32(header[:4]) {
+	case magic32, magic64, cigam32, cigam64, cigamFat, magicFat64, cigamFat64:
+		return true, nil
+	case magicFat:
+		// Java class files share the magic number, but have a version
+		// where universal binaries have the number of architectures.
+		return binary.BigEndian.Uint32(header[4:]) < maxFatArches, nil
+	}
+
+	return false, nil
+}
+
+// depth returns the number of elements of a path.
+func depth(path string) int {
+	return strings.Count(filepath.ToSlash(filepath.Clean(path)), "/")
+}
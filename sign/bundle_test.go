@@ -0,0 +1,180 @@
+package sign
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	childCommands["codesign-record"] = testCmdCodesignRecord
+}
+
+// recordEnv is the env var with the path of the file the fake codesign
+// appends its arguments to.
+const recordEnv = "GON_TEST_RECORD"
+
+// The headers of the fake binaries.
+var (
+	testMachO = []byte{0xcf, 0xfa, 0xed, 0xfe, 0x07, 0x00, 0x00, 0x01}
+	testFat   = []byte{0xca, 0xfe, 0xba, 0xbe, 0x00, 0x00, 0x00, 0x02}
+	testFat64 = []byte{0xca, 0xfe, 0xba, 0xbf, 0x00, 0x00, 0x00, 0x02}
+	testClass = []byte{0xca, 0xfe, 0xba, 0xbe, 0x00, 0x00, 0x00, 0x34}
+)
+
+func TestWalk(t *testing.T) {
+	td, err := ioutil.TempDir("", "gon")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	app := testBundle(t, td)
+	code, err := Walk(app)
+	require.NoError(t, err)
+
+	var result []string
+	for _, c := range code {
+		rel, err := filepath.Rel(app, c.Path)
+		require.NoError(t, err)
+		result = append(result, fmt.Sprintf("%s %s", c.Kind, filepath.ToSlash(rel)))
+	}
+
+	require.Equal(t, []string{
+		"library Contents/Frameworks/Foo.framework/Versions/A/Libraries/libbar.dylib",
+		"app Contents/Library/LoginItems/Login.app",
+		"framework Contents/Frameworks/Foo.framework",
+		"library Contents/Frameworks/libbaz.dylib",
+		"executable Contents/MacOS/tool",
+		"plugin Contents/PlugIns/Share.appex",
+		"plugin Contents/Resources/Plugin.bundle",
+		"xpc Contents/XPCServices/Helper.xpc",
+	}, result)
+}
+
+func TestSign_deep(t *testing.T) {
+	td, err := ioutil.TempDir("", "gon")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	app := testBundle(t, td)
+	record := filepath.Join(td, "record")
+	cmd := childCmd(t, "codesign-record")
+	cmd.Env = append(cmd.Env, recordEnv+"="+record)
+
+	require.NoError(t, Sign(context.Background(), &Options{
+		Files:          []string{app},
+		Identity:       "Developer ID Application: Example",
+		Entitlements:   "app.entitlements",
+		Identifier:     "com.example.app",
+		Timestamp:      TimestampNone,
+		RuntimeOptions: []string{"kill"},
+		Rules: []Rule{
+			{
+				Paths:        []string{filepath.Join(app, "Contents/XPCServices/*.xpc")},
+				Entitlements: "xpc.entitlements",
+			},
+		},
+		Deep:    true,
+		Logger:  hclog.L(),
+		BaseCmd: cmd,
+	}))
+
+	raw, err := ioutil.ReadFile(record)
+	require.NoError(t, err)
+	calls := strings.Split(strings.TrimSpace(strings.Replace(string(raw), app+"/", "", -1)), "\n")
+
+	// Inside out, the bundle last with its own settings
+	base := "-s\tDeveloper ID Application: Example\t-f\t-v\t--timestamp=none\t--options\t"
+	require.Equal(t, []string{
+		base + "runtime\tContents/Frameworks/Foo.framework/Versions/A/Libraries/libbar.dylib",
+		base + "runtime,kill\tContents/Library/LoginItems/Login.app",
+		base + "runtime\tContents/Frameworks/Foo.framework\tContents/Frameworks/libbaz.dylib",
+		base + "runtime,kill\tContents/MacOS/tool\tContents/PlugIns/Share.appex\tContents/Resources/Plugin.bundle",
+		base + "runtime\t--entitlements\txpc.entitlements\tContents/XPCServices/Helper.xpc",
+		"-s\tDeveloper ID Application: Example\t-f\t-v\t--identifier\tcom.example.app\t" +
+			"--timestamp=none\t--options\truntime,kill\t--entitlements\tapp.entitlements\t" + app,
+	}, calls)
+}
+
+func TestIsMachO(t *testing.T) {
+	td, err := ioutil.TempDir("", "gon")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	cases := map[string]struct {
+		content []byte
+		want    bool
+	}{
+		"macho": {testMachO, true},
+		"fat":   {testFat, true},
+		"fat64": {testFat64, true},
+		"class": {testClass, false},
+		"text":  {[]byte("#!/bin/sh\necho hi\n"), false},
+		"short": {testMachO[:4], false},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(td, name)
+			require.NoError(t, ioutil.WriteFile(path, tc.content, 0644))
+
+			ok, err := isMachO(path)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, ok)
+		})
+	}
+}
+
+// testBundle creates an app bundle with nested code in dir and returns its
+// path.
+func testBundle(t *testing.T, dir string) string {
+	t.Helper()
+
+	app := filepath.Join(dir, "App.app")
+	files := map[string][]byte{
+		"Contents/Info.plist": []byte("<plist><dict>\n\t<key>CFBundleExecutable</key>\n" +
+			"\t<string>Main</string>\n</dict></plist>\n"),
+		"Contents/MacOS/Main":                                                 testMachO,
+		"Contents/MacOS/tool":                                                 testFat,
+		"Contents/Resources/script.sh":                                        []byte("#!/bin/sh\n"),
+		"Contents/Resources/Classes.class":                                    testClass,
+		"Contents/Frameworks/libbaz.dylib":                                    testMachO,
+		"Contents/Frameworks/Foo.framework/Versions/A/Foo":                    testMachO,
+		"Contents/Frameworks/Foo.framework/Versions/A/Libraries/libbar.dylib": testMachO,
+		"Contents/XPCServices/Helper.xpc/Contents/MacOS/Helper":               testMachO,
+		"Contents/PlugIns/Share.appex/Contents/MacOS/Share":                   testMachO,
+		"Contents/Library/LoginItems/Login.app/Contents/MacOS/Login":          testMachO,
+		"Contents/Resources/Plugin.bundle/Plugin":                             testFat64,
+		"Contents/Resources/Assets.bundle/Contents/Resources/image.png":       []byte("png"),
+	}
+	for name, content := range files {
+		path := filepath.Join(app, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, content, 0755))
+	}
+
+	// The symbolic links of a framework aren't signed twice
+	framework := filepath.Join(app, "Contents", "Frameworks", "Foo.framework")
+	require.NoError(t, os.Symlink("A", filepath.Join(framework, "Versions", "Current")))
+	require.NoError(t, os.Symlink("Versions/Current/Foo", filepath.Join(framework, "Foo")))
+
+	return app
+}
+
+// testCmdCodesignRecord mimicks codesign, appending its arguments to the
+// record file.
+func testCmdCodesignRecord() int {
+	f, err := os.OpenFile(os.Getenv(recordEnv), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	fmt.Fprintln(f, strings.Join(os.Args[1:], "\t"))
+	return 0
+}
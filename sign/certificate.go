@@ -0,0 +1,174 @@
+package sign
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"time"
+)
+
+// The OIDs Apple marks Developer ID certificates with, and the extended key
+// usage of installer certificates.
+var (
+	oidDeveloperIDApplication = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 1, 13}
+	oidDeveloperIDInstaller   = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 1, 14}
+	oidInstallerUsage         = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 4, 13}
+)
+
+// appleRoots is the keychain with the root certificates macOS trusts.
+const appleRoots = "/System/Library/Keychains/SystemRootCertificates.keychain"
+
+// CheckOptions are the options for CheckCertificate.
+type CheckOptions struct {
+	// Installer, if true, checks for a "Developer ID Installer" certificate,
+	// which signs installer packages, rather than a "Developer ID
+	// Application" one.
+	Installer bool
+
+	// ExpiryWarning and ExpiryError are how long before the certificate
+	// expires CheckCertificate warns and fails. An expired certificate
+	// always fails.
+	ExpiryWarning time.Duration
+	ExpiryError   time.Duration
+
+	// Roots and Intermediates are the certificates the chain is verified
+	// with, see AppleCertificates. The chain isn't verified if Roots is nil.
+	Roots         *x509.CertPool
+	Intermediates *x509.CertPool
+
+	// Now is the time to check the certificate at. It's the current time
+	// if zero.
+	Now time.Time
+}
+
+// CheckCertificate checks that a signing certificate is valid and doesn't
+// expire too soon, and that it's a Developer ID certificate issued by
+// Apple. Only a certificate that can't sign now, or expires within
+// ExpiryError, is an error. Other problems, such as an upcoming expiry or
+// a certificate that can't be notarized, are returned as warnings.
+func CheckCertificate(cert *x509.Certificate, opts *CheckOptions) ([]string, error) {
+	name := cert.Subject.CommonName
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	left := cert.NotAfter.Sub(now)
+	expires := cert.NotAfter.Format("2006-01-02")
+	switch {
+	case now.Before(cert.NotBefore):
+		return nil, fmt.Errorf("certificate %q isn't valid before %s",
+			name, cert.NotBefore.Format("2006-01-02"))
+	case left <= 0:
+		return nil, fmt.Errorf("certificate %q expired on %s", name, expires)
+	case left <= opts.ExpiryError:
+		return nil, fmt.Errorf("certificate %q expires on %s, in %s", name, expires, days(left))
+	}
+
+	var warnings []string
+	kind, marker := DeveloperIDApplication, oidDeveloperIDApplication
+	if opts.Installer {
+		kind, marker = DeveloperIDInstaller, oidDeveloperIDInstaller
+	}
+	if !hasExtension(cert, marker) || !hasUsage(cert, opts.Installer) {
+		warnings = append(warnings, fmt.Sprintf(
+			"certificate %q isn't a %q certificate, notarization will fail", name, kind))
+	}
+
+	if opts.Roots != nil {
+		// Go doesn't know Apple's critical extensions, which would fail
+		// the verification.
+		verified := *cert
+		verified.UnhandledCriticalExtensions = nil
+		for _, oid := range cert.UnhandledCriticalExtensions {
+			if !oid.Equal(oidDeveloperIDApplication) && !oid.Equal(oidDeveloperIDInstaller) {
+				verified.UnhandledCriticalExtensions = append(verified.UnhandledCriticalExtensions, oid)
+			}
+		}
+
+		_, err := verified.Verify(x509.VerifyOptions{
+			Roots:         opts.Roots,
+			Intermediates: opts.Intermediates,
+			CurrentTime:   now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("certificate %q isn't issued by Apple: %s", name, err))
+		}
+	}
+
+	if left <= opts.ExpiryWarning {
+		warnings = append(warnings, fmt.Sprintf("certificate %q expires on %s, in %s", name, expires, days(left)))
+	}
+
+	return warnings, nil
+}
+
+// AppleCertificates returns the certificates to verify Developer ID
+// certificates with, exported from the keychains with `security
+// find-certificate`: the Apple root certificates macOS trusts and the
+// Developer ID certification authorities in the keychain search list.
+// opts.Keychain isn't used.
+func AppleCertificates(ctx context.Context, opts *IdentityOptions) (roots, intermediates *x509.CertPool, err error) {
+	out, err := security(ctx, opts, "find-certificate", "-a", "-c", "Apple Root CA", "-p", appleRoots)
+	if err != nil {
+		return nil, nil, err
+	}
+	roots = x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(out)) {
+		return nil, nil, fmt.Errorf("no Apple root certificates found in %s", appleRoots)
+	}
+
+	out, err = security(ctx, opts, "find-certificate", "-a", "-c", "Developer ID Certification Authority", "-p")
+	if err != nil {
+		return nil, nil, err
+	}
+	intermediates = x509.NewCertPool()
+	if !intermediates.AppendCertsFromPEM([]byte(out)) {
+		return nil, nil, fmt.Errorf("no Developer ID Certification Authority certificates found in the keychain")
+	}
+
+	return roots, intermediates, nil
+}
+
+// hasExtension returns true if the certificate has the extension.
+func hasExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasUsage returns true if the certificate may sign code, or installer
+// packages if installer is true.
+func hasUsage(cert *x509.Certificate, installer bool) bool {
+	if installer {
+		for _, oid := range cert.UnknownExtKeyUsage {
+			if oid.Equal(oidInstallerUsage) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageCodeSigning {
+			return true
+		}
+	}
+	return false
+}
+
+// days formats a duration in whole days.
+func days(d time.Duration) string {
+	n := int(d / (24 * time.Hour))
+	if n == 1 {
+		return "1 day"
+	}
+
+	return fmt.Sprintf("%d days", n)
+}
@@ -0,0 +1,194 @@
+package sign
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCertificate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	roots, intermediates, _, intermediate := testAuthorities(t, now)
+	_, _, other, _ := testAuthorities(t, now)
+	day := 24 * time.Hour
+
+	cases := []struct {
+		Name      string
+		NotAfter  time.Time
+		Installer bool
+		Issuer    *testAuthority
+		Warning   string
+		Err       string
+	}{
+		{
+			"valid",
+			now.Add(365 * day), false, intermediate,
+			"", "",
+		},
+		{
+			"installer",
+			now.Add(365 * day), true, intermediate,
+			"", "",
+		},
+		{
+			"expires soon",
+			now.Add(10*day + time.Hour), false, intermediate,
+			`certificate "Developer ID Application: Example Corp (ABCDE12345)" expires on 2026-01-11, in 10 days`, "",
+		},
+		{
+			"expires too soon",
+			now.Add(day + time.Hour), false, intermediate,
+			"", `certificate "Developer ID Application: Example Corp (ABCDE12345)" expires on 2026-01-02, in 1 day`,
+		},
+		{
+			"expired",
+			now.Add(-day), false, intermediate,
+			"", `certificate "Developer ID Application: Example Corp (ABCDE12345)" expired on 2025-12-31`,
+		},
+		{
+			"not issued by Apple",
+			now.Add(365 * day), false, other,
+			`certificate "Developer ID Application: Example Corp (ABCDE12345)" isn't issued by Apple`, "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			cert := testLeaf(t, tc.Issuer, now, tc.NotAfter, tc.Installer)
+
+			warnings, err := CheckCertificate(cert, &CheckOptions{
+				Installer:     tc.Installer,
+				ExpiryWarning: 30 * day,
+				ExpiryError:   2 * day,
+				Roots:         roots,
+				Intermediates: intermediates,
+				Now:           now,
+			})
+			if tc.Err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.Err)
+				return
+			}
+			require.NoError(t, err)
+
+			if tc.Warning == "" {
+				require.Empty(t, warnings)
+			} else {
+				require.Len(t, warnings, 1)
+				require.Contains(t, warnings[0], tc.Warning)
+			}
+		})
+	}
+}
+
+func TestCheckCertificate_kind(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, _, _, intermediate := testAuthorities(t, now)
+	cert := testLeaf(t, intermediate, now, now.Add(time.Hour), false)
+
+	// The wrong kind of certificate still signs, it only can't be notarized
+	warnings, err := CheckCertificate(cert, &CheckOptions{Installer: true, Now: now})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`certificate "Developer ID Application: Example Corp (ABCDE12345)" isn't a ` +
+			`"Developer ID Installer" certificate, notarization will fail`,
+	}, warnings)
+
+	// A certificate that isn't valid yet can't sign at all
+	_, err = CheckCertificate(cert, &CheckOptions{Now: now.Add(-48 * time.Hour)})
+	require.EqualError(t, err,
+		`certificate "Developer ID Application: Example Corp (ABCDE12345)" isn't valid before 2025-12-31`)
+}
+
+// testAuthority is a certificate authority that issues test certificates.
+type testAuthority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// testAuthorities returns a root and an intermediate authority, and pools
+// with their certificates.
+func testAuthorities(t *testing.T, now time.Time) (roots, intermediates *x509.CertPool, root, intermediate *testAuthority) {
+	t.Helper()
+
+	root = testIssue(t, nil, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Apple Root CA"},
+		NotBefore:             now.Add(-24 * time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	intermediate = testIssue(t, root, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Developer ID Certification Authority"},
+		NotBefore:             now.Add(-24 * time.Hour),
+		NotAfter:              now.AddDate(5, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+
+	roots = x509.NewCertPool()
+	roots.AddCert(root.cert)
+	intermediates = x509.NewCertPool()
+	intermediates.AddCert(intermediate.cert)
+
+	return roots, intermediates, root, intermediate
+}
+
+// testLeaf issues a Developer ID certificate marked like Apple does.
+func testLeaf(t *testing.T, issuer *testAuthority, now, notAfter time.Time, installer bool) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject: pkix.Name{
+			CommonName:         "Developer ID Application: Example Corp (ABCDE12345)",
+			OrganizationalUnit: []string{"ABCDE12345"},
+		},
+		NotBefore:       now.Add(-24 * time.Hour),
+		NotAfter:        notAfter,
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		ExtraExtensions: []pkix.Extension{{Id: oidDeveloperIDApplication, Critical: true, Value: asn1.NullBytes}},
+	}
+	if installer {
+		template.Subject.CommonName = "Developer ID Installer: Example Corp (ABCDE12345)"
+		template.ExtKeyUsage = nil
+		template.UnknownExtKeyUsage = []asn1.ObjectIdentifier{oidInstallerUsage}
+		template.ExtraExtensions = []pkix.Extension{{Id: oidDeveloperIDInstaller, Critical: true, Value: asn1.NullBytes}}
+	}
+
+	return testIssue(t, issuer, template).cert
+}
+
+// testIssue issues a certificate from the template, self-signed if issuer
+// is nil.
+func testIssue(t *testing.T, issuer *testAuthority, template *x509.Certificate) *testAuthority {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	parent, parentKey := template, key
+	if issuer != nil {
+		parent, parentKey = issuer.cert, issuer.key
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(raw)
+	require.NoError(t, err)
+
+	return &testAuthority{cert: cert, key: key}
+}
@@ -0,0 +1,210 @@
+package sign
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/bi-zone/gon/internal/securitycmd"
+	"github.com/bi-zone/gon/secret"
+)
+
+// DeveloperIDApplication and DeveloperIDInstaller are the prefixes of the
+// names of the identities that sign applications and installer packages
+// distributed outside the Mac App Store.
+const (
+	DeveloperIDApplication = "Developer ID Application"
+	DeveloperIDInstaller   = "Developer ID Installer"
+)
+
+// Identity is a code signing identity, a certificate and its private key,
+// in the keychain.
+type Identity struct {
+	// Hash is the SHA-1 hash of the certificate, in upper case hex. It's
+	// accepted by codesign -s and, unlike the name, always unambiguous.
+	Hash string
+
+	// Name is the common name of the certificate, such as
+	// "Developer ID Application: Example Corp (ABCDE12345)".
+	Name string
+}
+
+// IdentityOptions are the options for FindIdentities, FindIdentity and
+// Certificate.
+type IdentityOptions struct {
+	// Keychain, if set, is the path of the only keychain to search. The
+	// keychain search list is searched otherwise.
+	Keychain string
+
+	// Logger is the logger to use. If this is nil then no logging will be done.
+	Logger hclog.Logger
+
+	// Timeout, if positive, limits how long the security command may run.
+	Timeout time.Duration
+
+	// BaseCmd is the base command for executing the security binary. This is
+	// used for tests to overwrite where the security binary is.
+	BaseCmd *exec.Cmd
+}
+
+// identityRe matches an identity in the output of `security find-identity`.
+var identityRe = regexp.MustCompile(`^\s*\d+\)\s+([0-9A-Fa-f]{40})\s+"(.*)"`)
+
+// FindIdentities returns the valid code signing identities in the keychain,
+// as listed by `security find-identity -v -p codesigning`.
+func FindIdentities(ctx context.Context, opts *IdentityOptions) ([]*Identity, error) {
+	args := []string{"find-identity", "-v", "-p", "codesigning"}
+	if opts.Keychain != "" {
+		args = append(args, opts.Keychain)
+	}
+
+	out, err := security(ctx, opts, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseIdentities(out), nil
+}
+
+// parseIdentities parses the output of `security find-identity`. An
+// identity listed more than once is only returned once.
+func parseIdentities(out string) []*Identity {
+	var result []*Identity
+	seen := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		m := identityRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		hash := strings.ToUpper(m[1])
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		result = append(result, &Identity{Hash: hash, Name: m[2]})
+	}
+
+	return result
+}
+
+// FindIdentity returns the code signing identity that value refers to:
+// the identity with that hash or whose name contains value, like codesign
+// -s does. If value is empty, it's the "Developer ID Application" identity.
+// It's an error if no identity or more than one matches.
+func FindIdentity(ctx context.Context, value string, opts *IdentityOptions) (*Identity, error) {
+	identities, err := FindIdentities(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return matchIdentity(identities, value)
+}
+
+// matchIdentity implements FindIdentity for the given identities.
+func matchIdentity(identities []*Identity, value string) (*Identity, error) {
+	what := fmt.Sprintf("signing identity matching %q", value)
+	if value == "" {
+		what = fmt.Sprintf("%q signing identity", DeveloperIDApplication)
+	}
+
+	var matches []*Identity
+	for _, id := range identities {
+		var match bool
+		switch {
+		case value == "":
+			match = strings.HasPrefix(id.Name, DeveloperIDApplication+":")
+		case strings.EqualFold(id.Hash, value):
+			// The hash is exact, so no other identity counts
+			return id, nil
+		default:
+			match = strings.Contains(id.Name, value)
+		}
+		if match {
+			matches = append(matches, id)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no valid %s found in the keychain", what)
+	case 1:
+		return matches[0], nil
+	}
+
+	names := make([]string, len(matches))
+	for i, id := range matches {
+		names[i] = fmt.Sprintf("%q (%s)", id.Name, id.Hash)
+	}
+	return nil, fmt.Errorf("more than one %s found in the keychain, specify one of: %s",
+		what, strings.Join(names, ", "))
+}
+
+// Certificate returns the certificate of the identity, exported from the
+// keychain with `security find-certificate`.
+func Certificate(ctx context.Context, id *Identity, opts *IdentityOptions) (*x509.Certificate, error) {
+	args := []string{"find-certificate", "-a", "-c", id.Name, "-p"}
+	if opts.Keychain != "" {
+		args = append(args, opts.Keychain)
+	}
+
+	out, err := security(ctx, opts, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Certificates are looked up by name, so pick the one with the hash
+	rest := []byte(out)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		sum := sha1.Sum(block.Bytes)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), id.Hash) {
+			continue
+		}
+
+		return x509.ParseCertificate(block.Bytes)
+	}
+
+	return nil, fmt.Errorf("certificate of signing identity %q not found in the keychain", id.Name)
+}
+
+// TeamID returns the team ID of a Developer ID certificate, its subject's
+// organizational unit, or an empty string if it has none.
+func TeamID(cert *x509.Certificate) string {
+	if len(cert.Subject.OrganizationalUnit) == 0 {
+		return ""
+	}
+
+	return cert.Subject.OrganizationalUnit[0]
+}
+
+// security runs the security binary with the given arguments and returns
+// its standard output.
+func security(ctx context.Context, opts *IdentityOptions, args ...string) (string, error) {
+	// None of the commands take secrets, and -p is a policy or the PEM
+	// format rather than a password here, so the arguments are logged as is.
+	return securitycmd.Run(ctx, &securitycmd.Options{
+		Logger:  opts.Logger,
+		Timeout: opts.Timeout,
+		BaseCmd: opts.BaseCmd,
+		Redact:  secret.Redact,
+	}, args...)
+}
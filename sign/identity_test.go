@@ -0,0 +1,159 @@
+package sign
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	childCommands["security-identities"] = testCmdSecurityIdentities
+	childCommands["security-ambiguous"] = testCmdSecurityAmbiguous
+}
+
+// certEnv is the env var with the path of the PEM file the fake security
+// commands use as the certificate of the "Developer ID Application"
+// identity.
+const certEnv = "GON_TEST_CERT"
+
+// developmentHash is the hash of the "Apple Development" identity of the
+// fake security commands.
+const developmentHash = "0123456789ABCDEF0123456789ABCDEF01234567"
+
+func TestFindIdentity(t *testing.T) {
+	certPath := testCertificate(t, "Developer ID Application: Example Corp (ABCDE12345)", "ABCDE12345")
+	defer os.RemoveAll(filepath.Dir(certPath))
+
+	cmd := childCmd(t, "security-identities")
+	cmd.Env = append(cmd.Env, certEnv+"="+certPath)
+	opts := &IdentityOptions{Logger: hclog.L(), BaseCmd: cmd}
+
+	identities, err := FindIdentities(context.Background(), opts)
+	require.NoError(t, err)
+	require.Len(t, identities, 2)
+
+	// The Developer ID Application identity is the default
+	id, err := FindIdentity(context.Background(), "", opts)
+	require.NoError(t, err)
+	require.Equal(t, "Developer ID Application: Example Corp (ABCDE12345)", id.Name)
+	require.Equal(t, identities[0], id)
+
+	// Other identities are found by hash or name
+	id, err = FindIdentity(context.Background(), strings.ToLower(developmentHash), opts)
+	require.NoError(t, err)
+	require.Equal(t, "Apple Development: foo@example.com (XYZ9876543)", id.Name)
+
+	id, err = FindIdentity(context.Background(), "Apple Development", opts)
+	require.NoError(t, err)
+	require.Equal(t, developmentHash, id.Hash)
+
+	_, err = FindIdentity(context.Background(), "Developer ID Installer", opts)
+	require.EqualError(t, err,
+		`no valid signing identity matching "Developer ID Installer" found in the keychain`)
+
+	// The team ID is the organizational unit of the certificate
+	cert, err := Certificate(context.Background(), identities[0], opts)
+	require.NoError(t, err)
+	require.Equal(t, "ABCDE12345", TeamID(cert))
+}
+
+func TestFindIdentity_ambiguous(t *testing.T) {
+	_, err := FindIdentity(context.Background(), "", &IdentityOptions{
+		Logger:  hclog.L(),
+		BaseCmd: childCmd(t, "security-ambiguous"),
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `more than one "Developer ID Application" signing identity found`)
+	require.Contains(t, err.Error(), `"Developer ID Application: Example Corp (ABCDE12345)"`)
+	require.Contains(t, err.Error(), `"Developer ID Application: Other Corp (FGHIJ67890)"`)
+}
+
+// testCertificate writes a self-signed certificate to a PEM file in a new
+// temporary directory and returns its path.
+func testCertificate(t *testing.T, name, ou string) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName:         name,
+			OrganizationalUnit: []string{ou},
+		},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(24 * time.Hour),
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	td, err := ioutil.TempDir("", "gon")
+	require.NoError(t, err)
+
+	path := filepath.Join(td, "cert.pem")
+	err = ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: raw}), 0644)
+	require.NoError(t, err)
+
+	return path
+}
+
+// testCmdSecurityIdentities mimicks security with a "Developer ID
+// Application" identity, whose certificate is at $GON_TEST_CERT, and an
+// "Apple Development" identity.
+func testCmdSecurityIdentities() int {
+	raw, err := ioutil.ReadFile(os.Getenv(certEnv))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch os.Args[1] {
+	case "find-identity":
+		block, _ := pem.Decode(raw)
+		sum := sha1.Sum(block.Bytes)
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+		fmt.Printf(`  1) %[1]s "Developer ID Application: Example Corp (ABCDE12345)"
+  2) %[2]s "Apple Development: foo@example.com (XYZ9876543)"
+  3) %[1]s "Developer ID Application: Example Corp (ABCDE12345)"
+     3 valid identities found
+`, hash, developmentHash)
+
+	case "find-certificate":
+		os.Stdout.Write(raw)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %q\n", os.Args)
+		return 1
+	}
+
+	return 0
+}
+
+// testCmdSecurityAmbiguous mimicks security with two "Developer ID
+// Application" identities.
+func testCmdSecurityAmbiguous() int {
+	fmt.Print(`  1) 1111111111111111111111111111111111111111 "Developer ID Application: Example Corp (ABCDE12345)"
+  2) 2222222222222222222222222222222222222222 "Developer ID Application: Other Corp (FGHIJ67890)"
+     2 valid identities found
+`)
+	return 0
+}
@@ -7,8 +7,15 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
+
+	"github.com/bi-zone/gon/internal/execctx"
+	"github.com/bi-zone/gon/secret"
 )
 
 // Options are the options for Sign.
@@ -27,6 +34,60 @@ type Options struct {
 	// Entitlements is an (optional) path to a plist format .entitlements file
 	Entitlements string
 
+	// Identifier is the (optional) code signing identifier, see --identifier.
+	// If empty, a single file is signed with BundleId, and codesign derives
+	// the identifiers of several files from the bundle or the file name.
+	Identifier string
+
+	// BundleId is the (optional) identifier of a single file signed
+	// without an Identifier, such as the bundle ID being notarized.
+	BundleId string
+
+	// Prefix is the (optional) prefix of identifiers that codesign derives
+	// from the file name, see --prefix.
+	Prefix string
+
+	// Keychain is the (optional) path of the keychain to find the identity
+	// in, instead of the keychain search list.
+	Keychain string
+
+	// Timestamp is the time-stamping server to use. If empty, Apple's
+	// server is used, which notarization requires. TimestampNone disables
+	// time-stamping.
+	Timestamp string
+
+	// RuntimeOptions are the code signing flags to set in addition to the
+	// hardened runtime, such as "library" or "kill". See --options.
+	RuntimeOptions []string
+
+	// PreserveMetadata are the kinds of metadata of an existing signature
+	// to keep when re-signing, such as "entitlements" or "requirements".
+	// See --preserve-metadata.
+	PreserveMetadata []string
+
+	// StripDisallowedXattrs, if true, removes the extended attributes that
+	// would make signing fail, such as Finder info.
+	StripDisallowedXattrs bool
+
+	// ExtraArgs are passed to codesign as is, before the files. They're an
+	// escape hatch for flags that don't have an option.
+	ExtraArgs []string
+
+	// Rules are the settings of some of the files. Each file is signed
+	// with the first rule that matches it, or with the options above if
+	// none does. Files with the same settings are signed together, so
+	// codesign runs as few times as possible.
+	Rules []Rule
+
+	// Deep, if true, signs the code nested in the bundles among Files,
+	// such as frameworks, helper tools and XPC services, before the
+	// bundles, inside out (see Walk). Nested code isn't signed with the
+	// entitlements and identifier, which are those of the bundle, and
+	// libraries and frameworks aren't signed with the runtime options
+	// either. Rules, matched against the paths of the nested code, can set
+	// them. Unlike codesign --deep, the nested code is found by gon.
+	Deep bool
+
 	// Output is an io.Writer where the output of the command will be written.
 	// If this is nil then the output will only be sent to the log (if set)
 	// or in the error result value if signing failed.
@@ -35,13 +96,181 @@ type Options struct {
 	// Logger is the logger to use. If this is nil then no logging will be done.
 	Logger hclog.Logger
 
+	// Timeout, if positive, limits how long the codesign command may run.
+	Timeout time.Duration
+
 	// BaseCmd is the base command for executing the codesign binary. This is
 	// used for tests to overwrite where the codesign binary is.
 	BaseCmd *exec.Cmd
 }
 
+// Rule are the signing settings of the files matching one of its paths.
+// The entitlements, identifier and runtime options replace those of the
+// Options even if empty, so a rule can sign without entitlements. The
+// other settings are those of the Options.
+type Rule struct {
+	// Paths are the files the rule applies to, as paths or glob patterns
+	// (see filepath.Match). They are matched against Options.Files.
+	Paths []string
+
+	// Identity is the identity to sign with. Options.Identity is used if
+	// it's empty.
+	Identity string
+
+	Entitlements   string
+	Identifier     string
+	RuntimeOptions []string
+}
+
+// Matches returns true if the file matches one of the paths of the rule.
+// Invalid patterns don't match anything.
+func (r *Rule) Matches(file string) bool {
+	file = filepath.Clean(file)
+	for _, path := range r.Paths {
+		if ok, _ := filepath.Match(filepath.Clean(path), file); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TimestampNone is the Options.Timestamp value that disables time-stamping.
+const TimestampNone = "none"
+
 // Sign signs one or more files returning an error if any.
 func Sign(ctx context.Context, opts *Options) error {
+	steps, err := opts.steps()
+	if err != nil {
+		return err
+	}
+
+	for _, group := range steps {
+		if err := sign(ctx, group); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// steps returns the options of each codesign invocation, in order. With
+// Deep, the code nested in bundles comes first, deepest first, and the
+// files themselves last.
+func (opts *Options) steps() ([]*Options, error) {
+	if opts.Identifier == "" && len(opts.Files) == 1 {
+		withId := *opts
+		withId.Identifier = opts.BundleId
+		opts = &withId
+	}
+
+	if !opts.Deep {
+		return opts.groups(), nil
+	}
+
+	var nested []*Code
+	for _, file := range opts.Files {
+		if !IsBundle(file) {
+			continue
+		}
+
+		code, err := Walk(file)
+		if err != nil {
+			return nil, fmt.Errorf("error finding the code nested in %s: %w", file, err)
+		}
+		nested = append(nested, code...)
+	}
+
+	// Code at the same depth can't contain each other, so it's signed
+	// together, across bundles.
+	sort.SliceStable(nested, func(i, j int) bool {
+		return depth(nested[i].Path) > depth(nested[j].Path)
+	})
+
+	var result []*Options
+	for start := 0; start < len(nested); {
+		end := start
+		for end < len(nested) && depth(nested[end].Path) == depth(nested[start].Path) {
+			end++
+		}
+
+		libraries, others := opts.nested(true), opts.nested(false)
+		for _, code := range nested[start:end] {
+			if code.library() {
+				libraries.Files = append(libraries.Files, code.Path)
+			} else {
+				others.Files = append(others.Files, code.Path)
+			}
+		}
+		for _, level := range []*Options{libraries, others} {
+			if len(level.Files) > 0 {
+				result = append(result, level.groups()...)
+			}
+		}
+
+		start = end
+	}
+
+	return append(result, opts.groups()...), nil
+}
+
+// nested returns the options to sign nested code with, without files: the
+// options without the settings of the bundle, and for libraries and
+// frameworks without the runtime options.
+func (opts *Options) nested(library bool) *Options {
+	result := *opts
+	result.Files = nil
+	result.Deep = false
+	result.Entitlements = ""
+	result.Identifier = ""
+	if library {
+		result.RuntimeOptions = nil
+	}
+
+	return &result
+}
+
+// groups returns the options of each codesign invocation: the files with
+// the settings of the rule they match, grouped by their settings. The
+// groups are in the order of their first file.
+func (opts *Options) groups() []*Options {
+	var result []*Options
+	bySettings := map[string]*Options{}
+	for _, file := range opts.Files {
+		group := *opts
+		group.Files = nil
+		group.Rules = nil
+		for _, rule := range opts.Rules {
+			if !rule.Matches(file) {
+				continue
+			}
+
+			if rule.Identity != "" {
+				group.Identity = rule.Identity
+			}
+			group.Entitlements = rule.Entitlements
+			group.Identifier = rule.Identifier
+			group.RuntimeOptions = rule.RuntimeOptions
+			break
+		}
+
+		// The arguments without the files are the settings
+		key := strings.Join(group.args(), "\x00")
+		if existing, ok := bySettings[key]; ok {
+			existing.Files = append(existing.Files, file)
+			continue
+		}
+
+		group.Files = []string{file}
+		bySettings[key] = &group
+		result = append(result, &group)
+	}
+
+	return result
+}
+
+// sign runs codesign once for all the files of opts, ignoring the rules.
+func sign(ctx context.Context, opts *Options) error {
 	logger := opts.Logger
 	if logger == nil {
 		logger = hclog.NewNullLogger()
@@ -63,21 +292,7 @@ func Sign(ctx context.Context, opts *Options) error {
 		cmd.Path = path
 	}
 
-	cmd.Args = []string{
-		"codesign",
-		"-s", opts.Identity,
-		"-f",
-		"-v",
-		"--timestamp",
-		"--options", "runtime",
-	}
-
-	if len(opts.Entitlements) > 0 {
-		cmd.Args = append(cmd.Args, "--entitlements", opts.Entitlements)
-	}
-
-	// Append the files that we want to sign
-	cmd.Args = append(cmd.Args, opts.Files...)
+	cmd.Args = append([]string{"codesign"}, opts.args()...)
 
 	// We store all output in out for logging and in case there is an error
 	var out bytes.Buffer
@@ -95,15 +310,67 @@ func Sign(ctx context.Context, opts *Options) error {
 	logger.Info("executing codesigning",
 		"files", opts.Files,
 		"command_path", cmd.Path,
-		"command_args", cmd.Args,
+		"command_args", secret.RedactArgs(cmd.Args),
 	)
 
 	// Execute
-	if err := cmd.Run(); err != nil {
-		logger.Error("error codesigning", "err", err, "output", out.String())
-		return fmt.Errorf("error signing:\n\n%s", out.String())
+	if err := execctx.Run(ctx, &cmd, opts.Timeout); err != nil {
+		logger.Error("error codesigning", "err", err, "output", secret.Redact(out.String()))
+		if execctx.Stopped(err) {
+			return err
+		}
+		return fmt.Errorf("error signing:\n\n%s", secret.Redact(out.String()))
 	}
 
-	logger.Info("codesigning complete", "output", out.String())
+	logger.Info("codesigning complete", "output", secret.Redact(out.String()))
 	return nil
 }
+
+// args returns the codesign arguments for the options, including the
+// files.
+func (opts *Options) args() []string {
+	args := []string{
+		"-s", opts.Identity,
+		"-f",
+		"-v",
+	}
+
+	if opts.Keychain != "" {
+		args = append(args, "--keychain", opts.Keychain)
+	}
+	if opts.Identifier != "" {
+		args = append(args, "--identifier", opts.Identifier)
+	}
+	if opts.Prefix != "" {
+		args = append(args, "--prefix", opts.Prefix)
+	}
+
+	if opts.Timestamp == "" {
+		args = append(args, "--timestamp")
+	} else {
+		args = append(args, "--timestamp="+opts.Timestamp)
+	}
+
+	// The hardened runtime is required for notarization
+	flags := []string{"runtime"}
+	for _, flag := range opts.RuntimeOptions {
+		if flag != "runtime" {
+			flags = append(flags, flag)
+		}
+	}
+	args = append(args, "--options", strings.Join(flags, ","))
+
+	if len(opts.Entitlements) > 0 {
+		args = append(args, "--entitlements", opts.Entitlements)
+	}
+	if len(opts.PreserveMetadata) > 0 {
+		args = append(args, "--preserve-metadata="+strings.Join(opts.PreserveMetadata, ","))
+	}
+	if opts.StripDisallowedXattrs {
+		args = append(args, "--strip-disallowed-xattrs")
+	}
+	args = append(args, opts.ExtraArgs...)
+
+	// Append the files that we want to sign
+	return append(args, opts.Files...)
+}
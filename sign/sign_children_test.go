@@ -5,6 +5,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 // childEnv is the env var that must be set to trigger a child command.
@@ -13,6 +14,7 @@ const childEnv = "GON_TEST_CHILD"
 // childCommands is the list of commands we support
 var childCommands = map[string]func() int{
 	"success": childSuccess,
+	"sleep":   childSleep,
 }
 
 // childCmd is used to create a command that executes a command in the
@@ -40,3 +42,8 @@ func childSuccess() int {
 	println("success")
 	return 0
 }
+
+func childSleep() int {
+	time.Sleep(time.Minute)
+	return 0
+}
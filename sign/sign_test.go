@@ -2,13 +2,23 @@ package sign
 
 import (
 	"context"
+	"errors"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/sebdah/goldie"
 	"github.com/stretchr/testify/require"
+
+	"github.com/bi-zone/gon/internal/execctx"
 )
 
+func init() {
+	goldie.FixtureDir = "testdata"
+}
+
 func TestMain(m *testing.M) {
 	// Set our default logger
 	logger := hclog.L()
@@ -31,3 +41,181 @@ func TestSign_success(t *testing.T) {
 		BaseCmd:  childCmd(t, "success"),
 	}))
 }
+
+func TestSign_canceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := Sign(ctx, &Options{
+		Files:    []string{"foo"},
+		Identity: "bar",
+		Logger:   hclog.L(),
+		BaseCmd:  childCmd(t, "sleep"),
+	})
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.True(t, time.Since(start) < 30*time.Second)
+}
+
+func TestSign_timeout(t *testing.T) {
+	err := Sign(context.Background(), &Options{
+		Files:    []string{"foo"},
+		Identity: "bar",
+		Logger:   hclog.L(),
+		BaseCmd:  childCmd(t, "sleep"),
+		Timeout:  100 * time.Millisecond,
+	})
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	var terr *execctx.TimeoutError
+	require.True(t, errors.As(err, &terr))
+	require.Equal(t, "codesign", terr.Name)
+}
+
+func TestOptions_args(t *testing.T) {
+	cases := map[string]*Options{
+		"default": {},
+		"entitlements": {
+			Entitlements: "app.entitlements",
+		},
+		"identifier": {
+			Identifier: "com.example.app",
+		},
+		"bundle-id": {
+			Files:    []string{"foo"},
+			BundleId: "com.example.app",
+		},
+		"bundle-id-identifier": {
+			Files:      []string{"foo"},
+			Identifier: "com.example.foo",
+			BundleId:   "com.example.app",
+		},
+		"bundle-id-files": {
+			BundleId: "com.example.app",
+		},
+		"prefix": {
+			Prefix: "com.example.",
+		},
+		"keychain": {
+			Keychain: "/tmp/gon/signing.keychain-db",
+		},
+		"timestamp-url": {
+			Timestamp: "http://timestamp.example.com",
+		},
+		"timestamp-none": {
+			Timestamp: TimestampNone,
+		},
+		"runtime-options": {
+			RuntimeOptions: []string{"runtime", "library", "kill"},
+		},
+		"preserve-metadata": {
+			PreserveMetadata: []string{"entitlements", "requirements", "flags"},
+		},
+		"strip-disallowed-xattrs": {
+			StripDisallowedXattrs: true,
+		},
+		"extra-args": {
+			ExtraArgs: []string{"--deep", "--generate-entitlement-der"},
+		},
+		"all": {
+			Entitlements:          "app.entitlements",
+			Identifier:            "com.example.app",
+			Prefix:                "com.example.",
+			Keychain:              "/tmp/gon/signing.keychain-db",
+			Timestamp:             "http://timestamp.example.com",
+			RuntimeOptions:        []string{"library"},
+			PreserveMetadata:      []string{"entitlements"},
+			StripDisallowedXattrs: true,
+			ExtraArgs:             []string{"--deep"},
+		},
+	}
+
+	for name, opts := range cases {
+		t.Run(name, func(t *testing.T) {
+			opts.Identity = "Developer ID Application: Example"
+			if opts.Files == nil {
+				opts.Files = []string{"foo", "bar"}
+			}
+
+			steps, err := opts.steps()
+			require.NoError(t, err)
+			require.Len(t, steps, 1)
+			goldie.Assert(t, "args-"+name, []byte(strings.Join(steps[0].args(), "\n")+"\n"))
+		})
+	}
+}
+
+func TestOptions_groups(t *testing.T) {
+	opts := &Options{
+		Files: []string{
+			"./bin/app",
+			"./bin/helper-a",
+			"./lib/libfoo.dylib",
+			"./bin/helper-b",
+			"./bin/tool",
+		},
+		Identity:     "Developer ID Application: Example",
+		Entitlements: "app.entitlements",
+		Identifier:   "com.example.app",
+		Timestamp:    TimestampNone,
+		Rules: []Rule{
+			{
+				Paths:      []string{"bin/helper-*"},
+				Identifier: "com.example.helper",
+			},
+			{
+				Paths:          []string{"./lib/*.dylib", "./bin/tool"},
+				Identity:       "Developer ID Application: Other",
+				RuntimeOptions: []string{"library"},
+			},
+			{
+				// Only the first matching rule applies
+				Paths:        []string{"./bin/helper-b"},
+				Entitlements: "other.entitlements",
+			},
+		},
+	}
+
+	var groups [][]string
+	for _, g := range opts.groups() {
+		require.Nil(t, g.Rules)
+		groups = append(groups, g.args())
+	}
+
+	require.Equal(t, [][]string{
+		{
+			"-s", "Developer ID Application: Example", "-f", "-v",
+			"--identifier", "com.example.app",
+			"--timestamp=none",
+			"--options", "runtime",
+			"--entitlements", "app.entitlements",
+			"./bin/app",
+		},
+		{
+			"-s", "Developer ID Application: Example", "-f", "-v",
+			"--identifier", "com.example.helper",
+			"--timestamp=none",
+			"--options", "runtime",
+			"./bin/helper-a", "./bin/helper-b",
+		},
+		{
+			"-s", "Developer ID Application: Other", "-f", "-v",
+			"--timestamp=none",
+			"--options", "runtime,library",
+			"./lib/libfoo.dylib", "./bin/tool",
+		},
+	}, groups)
+
+	// Without rules all files are signed at once
+	opts.Rules = nil
+	require.Len(t, opts.groups(), 1)
+}
+
+func TestRule_Matches(t *testing.T) {
+	rule := &Rule{Paths: []string{"./bin/helper-*", "lib/libfoo.dylib", "[bad"}}
+	require.True(t, rule.Matches("bin/helper-a"))
+	require.True(t, rule.Matches("./bin/helper-b"))
+	require.True(t, rule.Matches("./lib/libfoo.dylib"))
+	require.False(t, rule.Matches("./bin/app"))
+	require.False(t, rule.Matches("./bin/sub/helper-a"))
+}
@@ -9,8 +9,12 @@ import (
 	"fmt"
 	"os/exec"
 	"path/filepath"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
+
+	"github.com/bi-zone/gon/internal/execctx"
+	"github.com/bi-zone/gon/secret"
 )
 
 // Options are the options for creating the zip archive.
@@ -21,6 +25,9 @@ type Options struct {
 	// Logger is the logger to use. If this is nil then no logging will be done.
 	Logger hclog.Logger
 
+	// Timeout, if positive, limits how long the stapler command may run.
+	Timeout time.Duration
+
 	// BaseCmd is the base command for executing the codesign binary. This is
 	// used for tests to overwrite where the codesign binary is.
 	BaseCmd *exec.Cmd
@@ -65,13 +72,16 @@ func Staple(ctx context.Context, opts *Options) error {
 	logger.Info("executing stapler",
 		"file", opts.File,
 		"command_path", cmd.Path,
-		"command_args", cmd.Args,
+		"command_args", secret.RedactArgs(cmd.Args),
 	)
 
 	// Execute
-	if err := cmd.Run(); err != nil {
-		logger.Error("error stapling", "err", err, "output", out.String())
-		return fmt.Errorf("error stapling:\n\n%s", out.String())
+	if err := execctx.Run(ctx, &cmd, opts.Timeout); err != nil {
+		logger.Error("error stapling", "err", err, "output", secret.Redact(out.String()))
+		if execctx.Stopped(err) {
+			return err
+		}
+		return fmt.Errorf("error stapling:\n\n%s", secret.Redact(out.String()))
 	}
 
 	logger.Info("stapling complete", "file", opts.File)